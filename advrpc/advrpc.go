@@ -5,18 +5,66 @@ package advrpc
 // however, its formal model says that rpc calls return arbitrary bytes.
 
 import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/goose-lang/primitive"
 	"github.com/mit-pdos/pav/marshalutil"
 	"github.com/mit-pdos/pav/netffi"
 	"github.com/tchajed/marshal"
 )
 
+// the framing versions this lib speaks.
+// on connect, the client sends its version range, and the server replies
+// with the highest shared version, or noVersion if there's none.
+//
+// version 1 frames are (rpcId ++ args) and (reply).
+// version 2 adds a call id, (callId ++ rpcId ++ args) and (callId ++ reply),
+// which lets a conn carry many in-flight calls.
+// servers speak both, but clients need version 2.
+const (
+	MinVersion    uint64 = 1
+	MaxVersion    uint64 = 2
+	callIdVersion uint64 = 2
+	noVersion     uint64 = 0
+)
+
+// backoff params, in nanoseconds.
+const (
+	dialRetries    uint64 = 5
+	dialBackoff    uint64 = 10_000_000
+	acceptBackoff  uint64 = 5_000_000
+	maxAcceptSleep uint64 = 1_000_000_000
+	// DefaultTimeout bounds each Call, in nanoseconds.
+	DefaultTimeout uint64 = 10_000_000_000
+)
+
+const (
+	// DefaultMaxConnCalls bounds the in-flight calls per server conn.
+	DefaultMaxConnCalls uint64 = 64
+)
+
 // # Server
 
 type Server struct {
 	handlers map[uint64]func([]byte, *[]byte)
+	// maxConnCalls bounds the handler threads per conn.
+	// once hit, the server stops reading from the conn.
+	maxConnCalls uint64
+
+	// mu protects the fields below, which track what Close shuts down.
+	mu        *sync.Mutex
+	closed    bool
+	listeners []*netffi.Listener
+	conns     map[*netffi.Conn]bool
+	// calls counts in-flight handlers.
+	calls *sync.WaitGroup
 }
 
-func (s *Server) handle(conn *netffi.Conn, rpcId uint64, data []byte) {
+// handle runs an rpc. callId is empty on conns without call ids.
+func (s *Server) handle(conn *netffi.Conn, callId []byte, rpcId uint64, data []byte) {
 	f, ok0 := s.handlers[rpcId]
 	if !ok0 {
 		// adv gave bad rpcId.
@@ -24,69 +72,468 @@ func (s *Server) handle(conn *netffi.Conn, rpcId uint64, data []byte) {
 	}
 	resp := new([]byte)
 	f(data, resp)
-	// ignore errors. if err, client will timeout, then retry.
-	conn.Send(*resp)
+	out0 := make([]byte, 0, uint64(len(callId))+uint64(len(*resp)))
+	out1 := marshal.WriteBytes(out0, callId)
+	out2 := marshal.WriteBytes(out1, *resp)
+	// ignore errors. if err, client will timeout.
+	conn.Send(out2)
+}
+
+// handshake agrees on a version with the client, and errors on fail.
+func (s *Server) handshake(conn *netffi.Conn) (uint64, bool) {
+	hello, err0 := conn.Receive()
+	if err0 {
+		return 0, true
+	}
+	cliMin, hello0, err1 := marshalutil.ReadInt(hello)
+	if err1 {
+		return 0, true
+	}
+	cliMax, _, err2 := marshalutil.ReadInt(hello0)
+	if err2 {
+		return 0, true
+	}
+	ver := pickVersion(cliMin, cliMax)
+	if conn.Send(marshal.WriteInt(make([]byte, 0, 8), ver)) {
+		return 0, true
+	}
+	return ver, ver == noVersion
+}
+
+// pickVersion returns the highest version in both our range and
+// [lo, hi], or noVersion if there's none.
+func pickVersion(lo, hi uint64) uint64 {
+	var ver = hi
+	if ver > MaxVersion {
+		ver = MaxVersion
+	}
+	if ver < lo || ver < MinVersion {
+		return noVersion
+	}
+	return ver
 }
 
 func (s *Server) read(conn *netffi.Conn) {
+	ver, err := s.handshake(conn)
+	if err {
+		s.dropConn(conn)
+		return
+	}
+	calls := make(chan struct{}, s.maxConnCalls)
 	for {
-		req, err0 := conn.Receive()
+		req0, err0 := conn.Receive()
 		if err0 {
 			// connection done. quit thread.
 			break
 		}
+		var callId []byte
+		var req = req0
+		if ver >= callIdVersion {
+			if len(req) < 8 {
+				// adv didn't even give callId.
+				continue
+			}
+			callId = req[:8]
+			req = req[8:]
+		}
 		rpcId, data, err1 := marshalutil.ReadInt(req)
 		if err1 {
 			// adv didn't even give rpcId.
 			continue
 		}
+		calls <- struct{}{}
+		if s.addCall() {
+			// drop new calls during shutdown. Close closes the conn
+			// once in-flight calls reply.
+			return
+		}
 		go func() {
-			s.handle(conn, rpcId, data)
+			s.handle(conn, callId, rpcId, data)
+			s.calls.Done()
+			<-calls
 		}()
 	}
+	s.dropConn(conn)
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	return closed
+}
+
+// addCall registers an in-flight call, and errors if the server closed.
+func (s *Server) addCall() bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return true
+	}
+	s.calls.Add(1)
+	s.mu.Unlock()
+	return false
+}
+
+// addConn tracks conn, and errors if the server closed.
+func (s *Server) addConn(conn *netffi.Conn) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return true
+	}
+	s.conns[conn] = true
+	s.mu.Unlock()
+	return false
 }
 
-func (s *Server) Serve(addr uint64) {
-	l := netffi.Listen(addr)
+func (s *Server) dropConn(conn *netffi.Conn) {
+	conn.Close()
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// Serve listens on addr and serves in the background.
+// it errors if it can't listen.
+func (s *Server) Serve(addr uint64) bool {
+	return s.ServeAddr(netffi.Uint64Addr(addr), nil)
+}
+
+// ServeAddr is like Serve, but with a general addr and transport opts,
+// which also set the server's frame, read timeout, and conn limits.
+func (s *Server) ServeAddr(addr *netffi.Addr, opts *netffi.Opts) bool {
+	l, err := netffi.ListenAddr(addr, opts)
+	if err {
+		return true
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return true
+	}
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
 	go func() {
-		for {
-			conn := l.Accept()
-			go func() {
-				s.read(conn)
-			}()
-		}
+		s.accept(l)
 	}()
+	return false
+}
+
+// accept loops until Close, backing off on accept errors,
+// which are often transient, e.g., from too many open files.
+func (s *Server) accept(l *netffi.Listener) {
+	var sleep = acceptBackoff
+	for {
+		conn, err := l.Accept()
+		if err {
+			if s.isClosed() {
+				break
+			}
+			log.Printf("advrpc: accept err on %s, retrying in %dms", l.Addr(), sleep/1_000_000)
+			primitive.Sleep(sleep)
+			if sleep < maxAcceptSleep {
+				sleep *= 2
+			}
+			continue
+		}
+		sleep = acceptBackoff
+		if s.addConn(conn) {
+			conn.Close()
+			break
+		}
+		go func() {
+			s.read(conn)
+		}()
+	}
+}
+
+// Close stops accepting conns and reading new calls, waits for in-flight
+// calls to reply, and then closes all conns.
+// the server can't Serve again after.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	listeners := s.listeners
+	s.listeners = nil
+	s.mu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+	// no new calls get added after closed is set.
+	s.calls.Wait()
+
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*netffi.Conn]bool)
+	s.mu.Unlock()
+	for conn := range conns {
+		conn.Close()
+	}
 }
 
 func NewServer(handlers map[uint64]func([]byte, *[]byte)) *Server {
-	return &Server{handlers: handlers}
+	return &Server{handlers: handlers, maxConnCalls: DefaultMaxConnCalls, mu: new(sync.Mutex), conns: make(map[*netffi.Conn]bool), calls: new(sync.WaitGroup)}
+}
+
+// SetMaxConnCalls sets the max in-flight calls per conn.
+// it must be called before Serve, and n must be positive.
+func (s *Server) SetMaxConnCalls(n uint64) {
+	s.maxConnCalls = n
 }
 
 // # Client
 
-// Client is meant for exclusive use.
+// Client is safe for concurrent use. calls share one conn, with replies
+// matched up by call id.
+// if the conn fails, the client reconnects on the next call.
 type Client struct {
+	mu   *sync.Mutex
+	addr *netffi.Addr
+	opts *netffi.Opts
+	// conn is nil if we need to reconnect.
+	conn    *clientConn
+	version uint64
+	// timeout bounds each call, in nanoseconds. 0 means no bound.
+	timeout uint64
+	nextId  uint64
+	// closed is set by Close, after which calls error.
+	closed bool
+}
+
+// clientConn is a conn with a reader thread that routes replies
+// to their calls.
+type clientConn struct {
 	conn *netffi.Conn
+	mu   *sync.Mutex
+	// pending maps call ids to waiting calls. closing a chan
+	// tells the call that the conn failed.
+	pending map[uint64]chan []byte
+	dead    bool
 }
 
-func Dial(addr uint64) *Client {
-	c := netffi.Dial(addr)
-	return &Client{conn: c}
+// Dial connects to addr and errors on fail.
+// it retries failed connects with exponential backoff,
+// which covers servers that are briefly down.
+func Dial(addr uint64) (*Client, bool) {
+	return DialAddr(netffi.Uint64Addr(addr), nil)
+}
+
+// DialAddr is like Dial, but with a general addr and transport opts.
+func DialAddr(addr *netffi.Addr, opts *netffi.Opts) (*Client, bool) {
+	conn, ver, err := dial(addr, opts)
+	if err {
+		return nil, true
+	}
+	return &Client{mu: new(sync.Mutex), addr: addr, opts: opts, conn: newClientConn(conn), version: ver, timeout: DefaultTimeout}, false
+}
+
+func newClientConn(conn *netffi.Conn) *clientConn {
+	cc := &clientConn{conn: conn, mu: new(sync.Mutex), pending: make(map[uint64]chan []byte)}
+	go func() {
+		cc.read()
+	}()
+	return cc
+}
+
+func (cc *clientConn) read() {
+	for {
+		resp, err0 := cc.conn.Receive()
+		if err0 {
+			break
+		}
+		callId, reply, err1 := marshalutil.ReadInt(resp)
+		if err1 {
+			continue
+		}
+		cc.mu.Lock()
+		ch, ok := cc.pending[callId]
+		// a missing call already gave up.
+		if ok {
+			delete(cc.pending, callId)
+			ch <- reply
+		}
+		cc.mu.Unlock()
+	}
+
+	cc.mu.Lock()
+	cc.dead = true
+	for _, ch := range cc.pending {
+		close(ch)
+	}
+	cc.pending = nil
+	cc.mu.Unlock()
+}
+
+// dial returns a conn and its version, and errors on fail.
+func dial(addr *netffi.Addr, opts *netffi.Opts) (*netffi.Conn, uint64, bool) {
+	var conn *netffi.Conn
+	var err0 = true
+	var sleep = dialBackoff
+	var i uint64
+	for ; i < dialRetries && err0; i++ {
+		if i != 0 {
+			primitive.Sleep(sleep)
+			sleep *= 2
+		}
+		conn, err0 = netffi.DialAddr(addr, opts)
+	}
+	if err0 {
+		return nil, 0, true
+	}
+	// no retry here. a server on a different version won't change.
+	ver, err1 := clientHandshake(conn)
+	if err1 {
+		conn.Close()
+		return nil, 0, true
+	}
+	return conn, ver, false
+}
+
+// clientHandshake returns the version that the server picked,
+// and errors on fail.
+func clientHandshake(c *netffi.Conn) (uint64, bool) {
+	hello0 := make([]byte, 0, 16)
+	hello1 := marshal.WriteInt(hello0, callIdVersion)
+	hello2 := marshal.WriteInt(hello1, MaxVersion)
+	if c.Send(hello2) {
+		return 0, true
+	}
+	resp, err0 := c.Receive()
+	if err0 {
+		return 0, true
+	}
+	ver, _, err1 := marshalutil.ReadInt(resp)
+	if err1 {
+		return 0, true
+	}
+	if ver < callIdVersion || ver > MaxVersion {
+		return 0, true
+	}
+	return ver, false
+}
+
+// Version returns the framing version agreed on with the server.
+func (c *Client) Version() uint64 {
+	c.mu.Lock()
+	ver := c.version
+	c.mu.Unlock()
+	return ver
+}
+
+// SetTimeout sets the per-call timeout, in nanoseconds.
+// 0 means no timeout.
+func (c *Client) SetTimeout(timeout uint64) {
+	c.mu.Lock()
+	c.timeout = timeout
+	c.mu.Unlock()
 }
 
 // Call does an rpc, and returns error on fail.
+// a call that times out might still run on the server,
+// so callers should only retry idempotent rpcs.
 func (c *Client) Call(rpcId uint64, args []byte, reply *[]byte) bool {
-	req0 := make([]byte, 0, 8+len(args))
-	req1 := marshal.WriteInt(req0, rpcId)
-	req2 := marshal.WriteBytes(req1, args)
-	if c.conn.Send(req2) {
+	return c.CallCtx(context.Background(), rpcId, args, reply)
+}
+
+// CallCtx is like Call, but it also errors once ctx is done.
+func (c *Client) CallCtx(ctx context.Context, rpcId uint64, args []byte, reply *[]byte) bool {
+	if ctx.Err() != nil {
 		return true
 	}
-
-	resp, err0 := c.conn.Receive()
+	cc, callId, timeout, err0 := c.getConn()
 	if err0 {
 		return true
 	}
-	*reply = resp
-	return false
+
+	ch := make(chan []byte, 1)
+	cc.mu.Lock()
+	if cc.dead {
+		cc.mu.Unlock()
+		return true
+	}
+	cc.pending[callId] = ch
+	cc.mu.Unlock()
+
+	req0 := make([]byte, 0, 8+8+len(args))
+	req1 := marshal.WriteInt(req0, callId)
+	req2 := marshal.WriteInt(req1, rpcId)
+	req3 := marshal.WriteBytes(req2, args)
+	if cc.conn.Send(req3) {
+		cc.forget(callId)
+		return true
+	}
+
+	var timer <-chan time.Time
+	if timeout != 0 {
+		t := time.NewTimer(time.Duration(timeout))
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			// conn failed.
+			return true
+		}
+		*reply = resp
+		return false
+	case <-timer:
+		cc.forget(callId)
+		return true
+	case <-ctx.Done():
+		cc.forget(callId)
+		return true
+	}
+}
+
+// getConn returns a live conn, a fresh call id, and the call timeout,
+// reconnecting if needed. it errors on fail.
+func (c *Client) getConn() (*clientConn, uint64, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, 0, 0, true
+	}
+	if c.conn != nil {
+		c.conn.mu.Lock()
+		dead := c.conn.dead
+		c.conn.mu.Unlock()
+		if dead {
+			c.conn = nil
+		}
+	}
+	if c.conn == nil {
+		conn, ver, err := dial(c.addr, c.opts)
+		if err {
+			return nil, 0, 0, true
+		}
+		c.conn = newClientConn(conn)
+		c.version = ver
+	}
+	callId := c.nextId
+	c.nextId++
+	return c.conn, callId, c.timeout, false
+}
+
+// Close closes the conn, which fails its in-flight calls.
+// later calls error, instead of reconnecting.
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	cc := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+	if cc != nil {
+		cc.conn.Close()
+	}
+}
+
+// forget drops a call that gave up, so its late reply gets ignored.
+func (cc *clientConn) forget(callId uint64) {
+	cc.mu.Lock()
+	delete(cc.pending, callId)
+	cc.mu.Unlock()
 }
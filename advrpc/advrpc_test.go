@@ -1,10 +1,14 @@
 package advrpc
 
 import (
+	"context"
+	"github.com/mit-pdos/pav/cryptoffi"
 	"github.com/mit-pdos/pav/marshalutil"
+	"github.com/mit-pdos/pav/netffi"
 	"github.com/tchajed/marshal"
 	"math/rand/v2"
 	"testing"
+	"time"
 )
 
 type Args struct {
@@ -64,9 +68,14 @@ func TestRPC(t *testing.T) {
 	}
 	s := NewServer(h)
 	addr := makeUniqueAddr()
-	s.Serve(addr)
+	if s.Serve(addr) {
+		t.Fatal()
+	}
 
-	c := Dial(addr)
+	c, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
 	args0 := &Args{A: 7, B: 8}
 	args1 := encArgs(args0)
 	reply0 := new([]byte)
@@ -84,6 +93,274 @@ func TestRPC(t *testing.T) {
 	}
 }
 
+func TestRPCTLS(t *testing.T) {
+	h := map[uint64]func([]byte, *[]byte){
+		2: servStub,
+	}
+	s := NewServer(h)
+	addr := makeUniqueAddr()
+	pk, sk := cryptoffi.SigGenerateKey()
+	if s.ServeAddr(netffi.Uint64Addr(addr), &netffi.Opts{TLS: cryptoffi.TLSServerConfig(sk)}) {
+		t.Fatal()
+	}
+
+	c, err0 := DialAddr(netffi.Uint64Addr(addr), &netffi.Opts{TLS: cryptoffi.TLSClientConfig(pk)})
+	if err0 {
+		t.Fatal()
+	}
+	reply0 := new([]byte)
+	if c.Call(2, encArgs(&Args{A: 7, B: 8}), reply0) {
+		t.Fatal()
+	}
+	reply1, err := decReply(reply0)
+	if err {
+		t.Fatal()
+	}
+	if reply1 != 7*8 {
+		t.Fatal()
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := map[uint64]func([]byte, *[]byte){
+		1: func(args []byte, reply *[]byte) {
+			time.Sleep(100 * time.Millisecond)
+		},
+		2: servStub,
+	}
+	s := NewServer(h)
+	addr := makeUniqueAddr()
+	if s.Serve(addr) {
+		t.Fatal()
+	}
+	c, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
+	reply := new([]byte)
+
+	// per-client timeout.
+	c.SetTimeout(10_000_000)
+	if !c.Call(1, nil, reply) {
+		t.Fatal()
+	}
+	// ctx deadline.
+	c.SetTimeout(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	if !c.CallCtx(ctx, 1, nil, reply) {
+		t.Fatal()
+	}
+	cancel()
+	// ctx cancel.
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if !c.CallCtx(ctx, 1, nil, reply) {
+		t.Fatal()
+	}
+
+	// client reconnects, without getting the late replies.
+	c.SetTimeout(DefaultTimeout)
+	for i := uint64(0); i < 5; i++ {
+		if c.Call(2, encArgs(&Args{A: i, B: 8}), reply) {
+			t.Fatal()
+		}
+		out, err1 := decReply(reply)
+		if err1 || out != i*8 {
+			t.Fatal()
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	h := map[uint64]func([]byte, *[]byte){
+		1: func(args []byte, reply *[]byte) {
+			time.Sleep(time.Duration(rand.IntN(10)) * time.Millisecond)
+			servStub(args, reply)
+		},
+	}
+	s := NewServer(h)
+	addr := makeUniqueAddr()
+	if s.Serve(addr) {
+		t.Fatal()
+	}
+	c, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
+
+	// out-of-order replies get routed to the right calls.
+	errs := make(chan bool, 50)
+	for i := uint64(0); i < 50; i++ {
+		go func() {
+			reply := new([]byte)
+			if c.Call(1, encArgs(&Args{A: i, B: 8}), reply) {
+				errs <- true
+				return
+			}
+			out, err1 := decReply(reply)
+			errs <- err1 || out != i*8
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		if <-errs {
+			t.Fatal()
+		}
+	}
+}
+
+func TestV1Client(t *testing.T) {
+	s := NewServer(map[uint64]func([]byte, *[]byte){2: servStub})
+	addr := makeUniqueAddr()
+	if s.Serve(addr) {
+		t.Fatal()
+	}
+	conn, err0 := netffi.Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
+	if conn.Send(marshal.WriteInt(marshal.WriteInt(nil, 1), 1)) {
+		t.Fatal()
+	}
+	resp, err1 := conn.Receive()
+	if err1 {
+		t.Fatal()
+	}
+	ver, _, err2 := marshalutil.ReadInt(resp)
+	if err2 || ver != 1 {
+		t.Fatal()
+	}
+
+	// v1 frames have no call id.
+	if conn.Send(marshal.WriteBytes(marshal.WriteInt(nil, 2), encArgs(&Args{A: 7, B: 8}))) {
+		t.Fatal()
+	}
+	reply, err3 := conn.Receive()
+	if err3 {
+		t.Fatal()
+	}
+	out, err4 := decReply(&reply)
+	if err4 || out != 7*8 {
+		t.Fatal()
+	}
+}
+
+func TestClose(t *testing.T) {
+	started := make(chan struct{})
+	h := map[uint64]func([]byte, *[]byte){
+		1: func(args []byte, reply *[]byte) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			servStub(args, reply)
+		},
+	}
+	s := NewServer(h)
+	addr := makeUniqueAddr()
+	if s.Serve(addr) {
+		t.Fatal()
+	}
+	c, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
+
+	// in-flight calls finish.
+	errs := make(chan bool)
+	go func() {
+		reply := new([]byte)
+		if c.Call(1, encArgs(&Args{A: 7, B: 8}), reply) {
+			errs <- true
+			return
+		}
+		out, err := decReply(reply)
+		errs <- err || out != 7*8
+	}()
+	<-started
+	s.Close()
+	if <-errs {
+		t.Fatal()
+	}
+
+	// no new calls or conns.
+	c.SetTimeout(100_000_000)
+	if !c.Call(1, encArgs(&Args{A: 7, B: 8}), new([]byte)) {
+		t.Fatal()
+	}
+	if _, err := netffi.Dial(addr); !err {
+		t.Fatal()
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	s := NewServer(map[uint64]func([]byte, *[]byte){1: servStub})
+	addr := makeUniqueAddr()
+	if s.Serve(addr) {
+		t.Fatal()
+	}
+	defer s.Close()
+	c, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
+	if c.Call(1, encArgs(&Args{A: 7, B: 8}), new([]byte)) {
+		t.Fatal()
+	}
+
+	// calls after Close don't reconnect, and a second Close is fine.
+	c.Close()
+	if !c.Call(1, encArgs(&Args{A: 7, B: 8}), new([]byte)) {
+		t.Fatal()
+	}
+	c.Close()
+}
+
+func TestDialErr(t *testing.T) {
+	// no server.
+	if _, err := Dial(makeUniqueAddr()); !err {
+		t.Fatal()
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	s := NewServer(map[uint64]func([]byte, *[]byte){})
+	addr := makeUniqueAddr()
+	if s.Serve(addr) {
+		t.Fatal()
+	}
+
+	c, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
+	if c.Version() != MaxVersion {
+		t.Fatal()
+	}
+
+	// server rejects a client with no shared versions.
+	conn, err1 := netffi.Dial(addr)
+	if err1 {
+		t.Fatal()
+	}
+	hello := marshal.WriteInt(marshal.WriteInt(nil, MaxVersion+1), MaxVersion+2)
+	if conn.Send(hello) {
+		t.Fatal()
+	}
+	resp, err0 := conn.Receive()
+	if err0 {
+		t.Fatal()
+	}
+	ver, _, err1 := marshalutil.ReadInt(resp)
+	if err1 || ver != noVersion {
+		t.Fatal()
+	}
+	// and then hangs up.
+	if _, err2 := conn.Receive(); !err2 {
+		t.Fatal()
+	}
+}
+
 func makeUniqueAddr() uint64 {
 	port := uint64(rand.IntN(4000)) + 6000
 	// left shift to make IP 0.0.0.0.
@@ -19,7 +19,7 @@ type setupParams struct {
 	servGood  bool
 	servAddr  uint64
 	servSigPk cryptoffi.SigPublicKey
-	servVrfPk []byte
+	servPrms  *kt.SigParams
 	adtrGood  bool
 	adtrAddrs []uint64
 	adtrPks   []cryptoffi.SigPublicKey
@@ -56,9 +56,11 @@ func checkCliErr(servGood bool, servPk cryptoffi.SigPublicKey, err *kt.ClientErr
 }
 
 func testAliceBob(setup *setupParams) {
-	aliceCli := kt.NewClient(aliceUid, setup.servAddr, setup.servSigPk, setup.servVrfPk)
+	aliceCli, err0 := kt.NewClient(aliceUid, setup.servAddr, setup.servSigPk, setup.servPrms)
+	std.Assert(!err0)
 	alice := &alice{servGood: setup.servGood, servSigPk: setup.servSigPk, cli: aliceCli}
-	bobCli := kt.NewClient(bobUid, setup.servAddr, setup.servSigPk, setup.servVrfPk)
+	bobCli, err1 := kt.NewClient(bobUid, setup.servAddr, setup.servSigPk, setup.servPrms)
+	std.Assert(!err1)
 	bob := &bob{servGood: setup.servGood, servSigPk: setup.servSigPk, cli: bobCli}
 
 	wg := new(sync.WaitGroup)
@@ -77,13 +79,13 @@ func testAliceBob(setup *setupParams) {
 	wg.Wait()
 
 	// alice self monitor. in real world, she'll come online at times and do this.
-	selfMonEp, err0 := alice.cli.SelfMon()
-	checkCliErr(setup.servGood, setup.servSigPk, err0)
+	selfMonEp, err2 := alice.cli.SelfMon()
+	checkCliErr(setup.servGood, setup.servSigPk, err2)
 	alice.hist = extendHist(alice.hist, selfMonEp+1)
 
 	if setup.adtrGood {
 		// sync auditors. in real world, this'll happen periodically.
-		updAdtrsAll(setup.servAddr, setup.adtrAddrs)
+		updAdtrsAll(setup.servAddr, setup.servSigPk, setup.adtrAddrs)
 
 		// alice and bob audit. ordering irrelevant across clients.
 		doAudits(alice.cli, setup.adtrAddrs, setup.adtrPks)
@@ -138,17 +140,16 @@ func (b *bob) run() {
 
 // setup starts server and auditors.
 func setup(servAddr uint64, adtrAddrs []uint64) *setupParams {
-	serv, servSigPk, servVrfPk := kt.NewServer()
-	servVrfPkEnc := cryptoffi.VrfPublicKeyEncode(servVrfPk)
+	serv, servSigPk, _ := kt.NewServer()
 	servRpc := kt.NewRpcServer(serv)
-	servRpc.Serve(servAddr)
+	primitive.Assume(!servRpc.Serve(servAddr))
 	var adtrPks []cryptoffi.SigPublicKey
 	for _, adtrAddr := range adtrAddrs {
-		adtr, adtrPk := kt.NewAuditor()
+		adtr, adtrPk := kt.NewAuditor(servSigPk)
 		adtrRpc := kt.NewRpcAuditor(adtr)
-		adtrRpc.Serve(adtrAddr)
+		primitive.Assume(!adtrRpc.Serve(adtrAddr))
 		adtrPks = append(adtrPks, adtrPk)
 	}
 	primitive.Sleep(1_000_000)
-	return &setupParams{servGood: true, servAddr: servAddr, servSigPk: servSigPk, servVrfPk: servVrfPkEnc, adtrGood: true, adtrAddrs: adtrAddrs, adtrPks: adtrPks}
+	return &setupParams{servGood: true, servAddr: servAddr, servSigPk: servSigPk, servPrms: serv.Params(), adtrGood: true, adtrAddrs: adtrAddrs, adtrPks: adtrPks}
 }
@@ -1,6 +1,8 @@
 package alicebob
 
 import (
+	"context"
+
 	"github.com/goose-lang/primitive"
 	"github.com/mit-pdos/pav/advrpc"
 	"github.com/mit-pdos/pav/cryptoffi"
@@ -10,7 +12,8 @@ import (
 func mkRpcClients(addrs []uint64) []*advrpc.Client {
 	var c []*advrpc.Client
 	for _, addr := range addrs {
-		cli := advrpc.Dial(addr)
+		cli, err := advrpc.Dial(addr)
+		primitive.Assume(!err)
 		c = append(c, cli)
 	}
 	return c
@@ -26,23 +29,24 @@ func doAudits(cli *kt.Client, adtrAddrs []uint64, adtrPks []cryptoffi.SigPublicK
 	}
 }
 
-func updAdtrsOnce(upd *kt.UpdateProof, adtrs []*advrpc.Client) {
+func updAdtrsOnce(servSigPk []byte, epoch uint64, upd *kt.UpdateProof, adtrs []*advrpc.Client) {
 	for _, cli := range adtrs {
-		err := kt.CallAdtrUpdate(cli, upd)
+		_, err := kt.CallAdtrUpdate(context.Background(), cli, servSigPk, epoch, upd)
 		primitive.Assume(!err)
 	}
 }
 
-func updAdtrsAll(servAddr uint64, adtrAddrs []uint64) {
-	servCli := advrpc.Dial(servAddr)
+func updAdtrsAll(servAddr uint64, servSigPk []byte, adtrAddrs []uint64) {
+	servCli, err0 := advrpc.Dial(servAddr)
+	primitive.Assume(!err0)
 	adtrs := mkRpcClients(adtrAddrs)
 	var epoch uint64
 	for {
-		upd, err := kt.CallServAudit(servCli, epoch)
+		upd, err := kt.CallServAudit(context.Background(), servCli, epoch)
 		if err {
 			break
 		}
-		updAdtrsOnce(upd, adtrs)
+		updAdtrsOnce(servSigPk, epoch, upd, adtrs)
 		epoch++
 	}
 }
@@ -4,24 +4,58 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"github.com/mit-pdos/pav/cryptoffi/vrf"
 	"hash"
+	"lukechampine.com/blake3"
+	"math/big"
+	"time"
 )
 
 const (
 	HashLen uint64 = 32
 )
 
+// hash suites. every suite outputs HashLen bytes.
+const (
+	HashSuiteSha256     uint64 = 0
+	HashSuiteSha512_256 uint64 = 1
+	HashSuiteBlake3     uint64 = 2
+)
+
 // # Hash
 
 type Hasher struct {
 	h hash.Hash
 }
 
+// NewHasher returns a hasher for the default suite, SHA-256.
 func NewHasher() *Hasher {
 	return &Hasher{sha256.New()}
 }
 
+// NewHasherSuite returns a hasher for suite, which must be valid.
+func NewHasherSuite(suite uint64) *Hasher {
+	switch suite {
+	case HashSuiteSha256:
+		return &Hasher{sha256.New()}
+	case HashSuiteSha512_256:
+		return &Hasher{sha512.New512_256()}
+	case HashSuiteBlake3:
+		return &Hasher{blake3.New(int(HashLen), nil)}
+	default:
+		panic("cryptoffi: unknown hash suite")
+	}
+}
+
+// CheckHashSuite errors if suite is unknown.
+func CheckHashSuite(suite uint64) bool {
+	return suite > HashSuiteBlake3
+}
+
 func (hr *Hasher) Write(b []byte) {
 	_, err := hr.h.Write(b)
 	if err != nil {
@@ -62,6 +96,46 @@ func (pk SigPublicKey) Verify(message []byte, sig []byte) bool {
 	return !ed25519.Verify(ed25519.PublicKey(pk), message, sig)
 }
 
+// # TLS
+
+// TLSServerConfig returns a TLS config that authenticates the server
+// with a self-signed cert for sk.
+func TLSServerConfig(sk *SigPrivateKey) *tls.Config {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC),
+	}
+	pk := sk.sk.Public()
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pk, sk.sk)
+	if err != nil {
+		panic("cryptoffi: TLS cert err")
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: sk.sk}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}
+}
+
+// TLSClientConfig returns a TLS config that only accepts servers
+// whose cert is for pk. it ignores cert chains and names,
+// since pk is all that clients trust.
+func TLSClientConfig(pk SigPublicKey) *tls.Config {
+	verify := func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("cryptoffi: no TLS cert")
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		certPk, ok := cert.PublicKey.(ed25519.PublicKey)
+		if !ok || !certPk.Equal(ed25519.PublicKey(pk)) {
+			return errors.New("cryptoffi: TLS cert for wrong pk")
+		}
+		return nil
+	}
+	return &tls.Config{InsecureSkipVerify: true, VerifyPeerCertificate: verify, MinVersion: tls.VersionTLS13}
+}
+
 // # VRF
 
 // VrfPrivateKey has an unexported sk, which can't be accessed outside
@@ -31,6 +31,37 @@ func TestHash(t *testing.T) {
 	}
 }
 
+func TestHashSuite(t *testing.T) {
+	suites := []uint64{HashSuiteSha256, HashSuiteSha512_256, HashSuiteBlake3}
+	var outs [][]byte
+	for _, suite := range suites {
+		if CheckHashSuite(suite) {
+			t.Fatal()
+		}
+		hr := NewHasherSuite(suite)
+		hr.Write([]byte("d1"))
+		h := hr.Sum(nil)
+		if uint64(len(h)) != HashLen {
+			t.Fatal()
+		}
+		outs = append(outs, h)
+	}
+	if !CheckHashSuite(HashSuiteBlake3 + 1) {
+		t.Fatal()
+	}
+
+	// default suite matches NewHasher.
+	hr := NewHasher()
+	hr.Write([]byte("d1"))
+	if !bytes.Equal(hr.Sum(nil), outs[0]) {
+		t.Fatal()
+	}
+	// suites are actually different.
+	if bytes.Equal(outs[0], outs[1]) || bytes.Equal(outs[0], outs[2]) || bytes.Equal(outs[1], outs[2]) {
+		t.Fatal()
+	}
+}
+
 func TestSig(t *testing.T) {
 	// verify true.
 	d := []byte("d")
@@ -9,3 +9,10 @@ func Hash(b []byte) []byte {
 	hr.Write(b)
 	return hr.Sum(nil)
 }
+
+// HashSuite is like Hash, but with a particular hash suite.
+func HashSuite(suite uint64, b []byte) []byte {
+	hr := cryptoffi.NewHasherSuite(suite)
+	hr.Write(b)
+	return hr.Sum(nil)
+}
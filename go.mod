@@ -11,11 +11,13 @@ require (
 	github.com/stretchr/testify v1.10.0
 	github.com/tchajed/marshal v0.6.5
 	golang.org/x/tools v0.34.0
+	lukechampine.com/blake3 v1.4.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/elastic/go-windows v1.0.2 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/prometheus/procfs v0.15.1 // indirect
 	golang.org/x/mod v0.25.0 // indirect
@@ -1,62 +1,262 @@
 package kt
 
 import (
+	"context"
 	"github.com/goose-lang/std"
+	"github.com/mit-pdos/pav/advrpc"
 	"github.com/mit-pdos/pav/cryptoffi"
 	"github.com/mit-pdos/pav/merkle"
 	"sync"
 )
 
+const (
+	// maxAdtrGetMany bounds the epochs in a GetMany.
+	maxAdtrGetMany uint64 = 1024
+)
+
+// Auditor keeps a log for each audited server.
 type Auditor struct {
-	mu       *sync.Mutex
-	sk       *cryptoffi.SigPrivateKey
-	keyMap   *merkle.Tree
-	histInfo []*AdtrEpochInfo
+	// mu protects logs and closed. each log has its own lock.
+	mu   *sync.RWMutex
+	sk   *cryptoffi.SigPrivateKey
+	logs map[string]*adtrLog
+	// closed is set by Close, after which calls error.
+	closed bool
+}
+
+// adtrLog audits a single server.
+type adtrLog struct {
+	mu        *sync.Mutex
+	servSigPk cryptoffi.SigPublicKey
+	keyMap    *merkle.Tree
+	histInfo  []*AdtrEpochInfo
+	// closed is set once keyMap is closed.
+	closed bool
 }
 
-// Update checks new epoch updates, applies them, and errors on fail.
-func (a *Auditor) Update(proof *UpdateProof) bool {
+// AddLog starts a log for the server with servSigPk, whose hash suite
+// is suite. it errors if the log already exists or suite is unknown.
+func (a *Auditor) AddLog(suite uint64, servSigPk cryptoffi.SigPublicKey) bool {
+	if cryptoffi.CheckHashSuite(suite) {
+		return true
+	}
 	a.mu.Lock()
-	nextEp := uint64(len(a.histInfo))
-	if checkUpd(a.keyMap, nextEp, proof.Updates) {
+	_, ok := a.logs[string(servSigPk)]
+	if ok || a.closed {
 		a.mu.Unlock()
 		return true
 	}
-	applyUpd(a.keyMap, proof.Updates)
+	a.logs[string(servSigPk)] = &adtrLog{mu: new(sync.Mutex), servSigPk: servSigPk, keyMap: merkle.NewTreeSuite(suite)}
+	a.mu.Unlock()
+	return false
+}
+
+// getLog errors if there's no log with logId, or if the auditor closed.
+func (a *Auditor) getLog(logId []byte) (*adtrLog, bool) {
+	a.mu.RLock()
+	l, ok := a.logs[string(logId)]
+	closed := a.closed
+	a.mu.RUnlock()
+	return l, !ok || closed
+}
+
+// Update checks new epoch updates for the log with logId, applies them,
+// and errors on fail.
+// it only advances if the server signed the dig that results from
+// the updates. if the server signed some other dig, it returns evid.
+func (a *Auditor) Update(logId []byte, proof *UpdateProof) (*UpdEvid, bool) {
+	l, err := a.getLog(logId)
+	if err {
+		return nil, true
+	}
+	return l.update(a.sk, proof)
+}
+
+func (l *adtrLog) update(sk *cryptoffi.SigPrivateKey, proof *UpdateProof) (*UpdEvid, bool) {
+	l.mu.Lock()
+	// a racing Close might have closed keyMap.
+	if l.closed {
+		l.mu.Unlock()
+		return nil, true
+	}
+	nextEp := uint64(len(l.histInfo))
+	if checkUpd(l.keyMap, nextEp, proof.Updates) {
+		l.mu.Unlock()
+		return nil, true
+	}
+	servDig := &SigDig{Epoch: nextEp, Dig: proof.Dig, Sig: proof.Sig}
+	if CheckSigDig(servDig, l.servSigPk) {
+		l.mu.Unlock()
+		return nil, true
+	}
+	// without the server vouching for the updates, a mismatch isn't evid.
+	if CheckUpdSig(nextEp, proof.Dig, proof.Updates, proof.UpdSig, l.servSigPk) {
+		l.mu.Unlock()
+		return nil, true
+	}
+	// apply to a copy, so a bad proof leaves the map as is.
+	keyMap := l.keyMap.Clone()
+	applyUpd(keyMap, proof.Updates)
+	dig := keyMap.Digest()
+	if !std.BytesEqual(dig, proof.Dig) {
+		l.mu.Unlock()
+		return &UpdEvid{ServDig: servDig, Updates: proof.Updates, UpdSig: proof.UpdSig}, true
+	}
+	l.keyMap = keyMap
+	// the auditor's map is in memory, so it can't fail.
+	snap, err1 := l.keyMap.Snapshot()
+	std.Assert(!err1)
+	std.Assert(snap == nextEp)
+	// auditors only check the latest map, so they keep no old roots.
+	l.keyMap.Prune(snap)
 
-	dig := a.keyMap.Digest()
 	// sign dig.
-	preSig := &PreSigDig{Epoch: nextEp, Dig: dig}
-	preSigByt := PreSigDigEncode(make([]byte, 0, 8+8+cryptoffi.HashLen), preSig)
-	sig := a.sk.Sign(preSigByt)
+	preSig := &PreSigAdtrDig{LogId: l.servSigPk, Epoch: nextEp, Dig: dig}
+	preSigByt := PreSigAdtrDigEncode(make([]byte, 0, 8+uint64(len(l.servSigPk))+8+8+cryptoffi.HashLen), preSig)
+	sig := sk.Sign(preSigByt)
 	// benchmark: turn off sigs for akd compat.
 	// var sig []byte
 
 	newInfo := &AdtrEpochInfo{Dig: dig, ServSig: proof.Sig, AdtrSig: sig}
-	a.histInfo = append(a.histInfo, newInfo)
-	a.mu.Unlock()
-	return false
+	l.histInfo = append(l.histInfo, newInfo)
+	l.mu.Unlock()
+	return nil, false
 }
 
-// Get returns the auditor's dig for a particular epoch, and errors on fail.
-func (a *Auditor) Get(epoch uint64) (*AdtrEpochInfo, bool) {
-	a.mu.Lock()
-	numEpochs := uint64(len(a.histInfo))
+// UpdateMany calls Update on each proof in order, and errors / evid on
+// the first fail. the proofs before the failed one stay applied.
+func (a *Auditor) UpdateMany(logId []byte, proofs []*UpdateProof) (*UpdEvid, bool) {
+	for _, p := range proofs {
+		evid, err := a.Update(logId, p)
+		if err {
+			return evid, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the auditor's dig for a particular log and epoch,
+// and errors on fail.
+func (a *Auditor) Get(logId []byte, epoch uint64) (*AdtrEpochInfo, bool) {
+	l, err := a.getLog(logId)
+	if err {
+		return &AdtrEpochInfo{}, true
+	}
+	l.mu.Lock()
+	numEpochs := uint64(len(l.histInfo))
 	if epoch >= numEpochs {
-		a.mu.Unlock()
+		l.mu.Unlock()
 		return &AdtrEpochInfo{}, true
 	}
 
-	info := a.histInfo[epoch]
-	a.mu.Unlock()
+	info := l.histInfo[epoch]
+	l.mu.Unlock()
 	return info, false
 }
 
-func NewAuditor() (*Auditor, cryptoffi.SigPublicKey) {
-	mu := new(sync.Mutex)
+// GetMany is like Get, for each of epochs.
+// it errors if any epoch fails, or if there are more than maxAdtrGetMany.
+func (a *Auditor) GetMany(logId []byte, epochs []uint64) ([]*AdtrEpochInfo, bool) {
+	if uint64(len(epochs)) > maxAdtrGetMany {
+		return nil, true
+	}
+	l, err := a.getLog(logId)
+	if err {
+		return nil, true
+	}
+	infos := make([]*AdtrEpochInfo, 0, len(epochs))
+	l.mu.Lock()
+	numEpochs := uint64(len(l.histInfo))
+	for _, epoch := range epochs {
+		if epoch >= numEpochs {
+			l.mu.Unlock()
+			return nil, true
+		}
+		infos = append(infos, l.histInfo[epoch])
+	}
+	l.mu.Unlock()
+	return infos, false
+}
+
+// Follow is unverified. it keeps the log with logId in lockstep with
+// its server, catching up in ranges and then long-polling for each new epoch.
+// it returns once ctx is done or the auditor closes, and errors on
+// those, on a missing log, or on a bad update from the server,
+// which it gives evid for.
+// it shouldn't run alongside other Update callers for the log.
+func (a *Auditor) Follow(ctx context.Context, logId []byte, servCli *advrpc.Client) (*UpdEvid, bool) {
+	for {
+		if ctx.Err() != nil {
+			return nil, true
+		}
+		l, err := a.getLog(logId)
+		if err {
+			return nil, true
+		}
+		l.mu.Lock()
+		epoch := uint64(len(l.histInfo))
+		l.mu.Unlock()
+		ps, _, err0 := CallServAuditRange(ctx, servCli, epoch, maxAuditRange)
+		if !err0 && len(ps) != 0 {
+			evid, err2 := a.UpdateMany(logId, ps)
+			if err2 {
+				return evid, true
+			}
+			continue
+		}
+		p, err1 := CallServAuditWait(ctx, servCli, epoch)
+		if err1 {
+			// no new epoch yet, or the server is down.
+			continue
+		}
+		evid, err3 := l.update(a.sk, p)
+		if err3 {
+			return evid, true
+		}
+	}
+}
+
+// Close closes the key maps of all logs, and errors on fail.
+// later calls error, and a second Close does nothing.
+func (a *Auditor) Close() bool {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return false
+	}
+	a.closed = true
+	var err0 bool
+	for _, l := range a.logs {
+		l.mu.Lock()
+		l.closed = true
+		if l.keyMap.Close() {
+			err0 = true
+		}
+		l.mu.Unlock()
+	}
+	a.mu.Unlock()
+	return err0
+}
+
+// NewAuditor makes an auditor with one log, for the server with servSigPk.
+func NewAuditor(servSigPk cryptoffi.SigPublicKey) (*Auditor, cryptoffi.SigPublicKey) {
+	return NewAuditorSuite(cryptoffi.HashSuiteSha256, servSigPk)
+}
+
+// NewAuditorSuite is like NewAuditor, for a server that hashes with suite,
+// which must be valid.
+func NewAuditorSuite(suite uint64, servSigPk cryptoffi.SigPublicKey) (*Auditor, cryptoffi.SigPublicKey) {
+	a, pk := NewMultiAuditor()
+	std.Assert(!a.AddLog(suite, servSigPk))
+	return a, pk
+}
+
+// NewMultiAuditor makes an auditor with no logs. see AddLog.
+func NewMultiAuditor() (*Auditor, cryptoffi.SigPublicKey) {
+	mu := new(sync.RWMutex)
 	pk, sk := cryptoffi.SigGenerateKey()
-	m := merkle.NewTree()
-	return &Auditor{mu: mu, sk: sk, keyMap: m}, pk
+	logs := make(map[string]*adtrLog)
+	return &Auditor{mu: mu, sk: sk, logs: logs}, pk
 }
 
 func checkUpd(keys *merkle.Tree, nextEp uint64, upd map[string][]byte) bool {
@@ -70,15 +270,21 @@ func checkUpd(keys *merkle.Tree, nextEp uint64, upd map[string][]byte) bool {
 }
 
 // checkOneUpd checks that an update is safe to apply, and errs on fail.
+// versioned labels are add-only, with a MapValPre for this epoch.
+// latest labels, with a MapLatestValPre, are the only ones that
+// the server can update.
 func checkOneUpd(keys *merkle.Tree, nextEp uint64, mapLabel, mapVal []byte) bool {
 	// used in applyUpd.
 	if uint64(len(mapLabel)) != cryptoffi.HashLen {
 		return true
 	}
-	inTree, _ := keys.Get(mapLabel)
-	// label not already in keyMap. map monotonicity.
+	inTree, oldVal := keys.Get(mapLabel)
 	if inTree {
-		return true
+		// a latest label stays one.
+		return !isLatestVal(oldVal) || !isLatestVal(mapVal)
+	}
+	if isLatestVal(mapVal) {
+		return false
 	}
 
 	valPre, rem, err1 := MapValPreDecode(mapVal)
@@ -91,6 +297,10 @@ func checkOneUpd(keys *merkle.Tree, nextEp uint64, mapLabel, mapVal []byte) bool
 	if len(rem) != 0 {
 		return true
 	}
+	// fixed commit len keeps MapValPre and MapLatestValPre apart.
+	if uint64(len(valPre.PkCommit)) != cryptoffi.HashLen {
+		return true
+	}
 	// epoch ok.
 	if valPre.Epoch != nextEp {
 		return true
@@ -98,10 +308,23 @@ func checkOneUpd(keys *merkle.Tree, nextEp uint64, mapLabel, mapVal []byte) bool
 	return false
 }
 
+// isLatestVal is whether val exactly encodes a MapLatestValPre.
+func isLatestVal(val []byte) bool {
+	valPre, rem, err := MapLatestValPreDecode(val)
+	if err || len(rem) != 0 {
+		return false
+	}
+	return uint64(len(valPre.PkCommit)) == cryptoffi.HashLen
+}
+
 // applyUpd applies a valid update to the previous map.
 func applyUpd(keys *merkle.Tree, upd map[string][]byte) {
+	labels := make([][]byte, 0, len(upd))
+	vals := make([][]byte, 0, len(upd))
 	for label, val := range upd {
-		err0 := keys.Put([]byte(label), val)
-		std.Assert(!err0)
+		labels = append(labels, []byte(label))
+		vals = append(vals, val)
 	}
+	err0 := keys.PutBatch(labels, vals)
+	std.Assert(!err0)
 }
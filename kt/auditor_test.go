@@ -0,0 +1,377 @@
+package kt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mit-pdos/pav/advrpc"
+	"github.com/mit-pdos/pav/cryptoffi"
+	"github.com/mit-pdos/pav/merkle"
+)
+
+func TestAuditWait(t *testing.T) {
+	serv, _, _ := NewServer()
+	// epoch 0 already exists.
+	if _, err := serv.AuditWait(0); err {
+		t.Fatal()
+	}
+	got := make(chan bool)
+	go func() {
+		_, err := serv.AuditWait(1)
+		got <- !err
+	}()
+	select {
+	case <-got:
+		t.Fatal()
+	case <-time.After(20 * time.Millisecond):
+	}
+	serv.Put(0, []byte{1})
+	if !<-got {
+		t.Fatal()
+	}
+}
+
+func TestAuditRange(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	servCli, err0 := advrpc.Dial(servAddr)
+	if err0 {
+		t.Fatal()
+	}
+	for uid := uint64(0); uid < 10; uid++ {
+		if _, _, _, err := serv.Put(uid, []byte{1}); err {
+			t.Fatal()
+		}
+	}
+
+	// page through all epochs.
+	aud, _ := NewAuditor(sigPk)
+	var next uint64
+	for {
+		ps, next0, err1 := CallServAuditRange(context.Background(), servCli, next, 3)
+		if err1 || uint64(len(ps)) > 3 {
+			t.Fatal()
+		}
+		if len(ps) == 0 {
+			break
+		}
+		if _, err := aud.UpdateMany(sigPk, ps); err {
+			t.Fatal()
+		}
+		next = next0
+	}
+	dig, _, _ := serv.SelfMon(0)
+	if next != dig.Epoch+1 {
+		t.Fatal()
+	}
+	info, err2 := aud.Get(sigPk, dig.Epoch)
+	if err2 || !bytes.Equal(info.Dig, dig.Dig) {
+		t.Fatal()
+	}
+
+	// bad start.
+	if _, _, err := serv.AuditRange(next+1, 1); !err {
+		t.Fatal()
+	}
+	// re-applying epochs fails.
+	ps, _, _ := serv.AuditRange(1, 1)
+	if _, err := aud.UpdateMany(sigPk, ps); !err {
+		t.Fatal()
+	}
+}
+
+func TestUpdateSig(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	if _, _, _, err := serv.Put(0, []byte{1}); err {
+		t.Fatal()
+	}
+	aud, _ := NewAuditor(sigPk)
+	p0, _ := serv.Audit(0)
+	if _, err := aud.Update(sigPk, p0); err {
+		t.Fatal()
+	}
+	p1, _ := serv.Audit(1)
+
+	// bad sig.
+	bad0 := &UpdateProof{Updates: p1.Updates, Dig: p1.Dig, Sig: p0.Sig}
+	if evid, err := aud.Update(sigPk, bad0); !err || evid != nil {
+		t.Fatal()
+	}
+	// updates that the server didn't vouch for aren't evid.
+	bad1 := &UpdateProof{Updates: map[string][]byte{}, Dig: p1.Dig, Sig: p1.Sig, UpdSig: p1.UpdSig}
+	if evid, err := aud.Update(sigPk, bad1); !err || evid != nil {
+		t.Fatal()
+	}
+	// the server signed a dig that doesn't match its updates.
+	bad2 := forgeUpd(serv.sigSk, 1, p1.Dig, map[string][]byte{})
+	evid, err0 := aud.Update(sigPk, bad2)
+	if !err0 || evid == nil || evid.Check(sigPk) {
+		t.Fatal()
+	}
+
+	// failed updates don't advance the auditor.
+	if _, err := aud.Get(sigPk, 1); !err {
+		t.Fatal()
+	}
+	if _, err := aud.Update(sigPk, p1); err {
+		t.Fatal()
+	}
+	info, err1 := aud.Get(sigPk, 1)
+	if err1 || !bytes.Equal(info.Dig, p1.Dig) {
+		t.Fatal()
+	}
+}
+
+func TestUpdateLatest(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	for i := byte(0); i < 2; i++ {
+		if _, _, _, err := serv.Put(0, []byte{i}); err {
+			t.Fatal()
+		}
+	}
+	// each put re-commits the latest label.
+	aud, _ := NewAuditor(sigPk)
+	for e := uint64(0); e < 3; e++ {
+		p, _ := serv.Audit(e)
+		if _, err := aud.Update(sigPk, p); err {
+			t.Fatal()
+		}
+	}
+
+	keys := merkle.NewTree()
+	p1, _ := serv.Audit(1)
+	applyUpd(keys, p1.Updates)
+	verLabel, _ := compMapLabel(0, 0, serv.vrfSk)
+	latestLabel, _ := compLatestLabel(0, serv.vrfSk)
+	open := &CommitOpen{Val: []byte{2}, Rand: make([]byte, cryptoffi.HashLen)}
+	mapVal := compMapVal(serv.suite, 2, open)
+	latestVal := compLatestVal(serv.suite, open)
+	if checkOneUpd(keys, 2, latestLabel, latestVal) {
+		t.Fatal()
+	}
+	// versioned labels are add-only.
+	if !checkOneUpd(keys, 2, verLabel, mapVal) {
+		t.Fatal()
+	}
+	// neither label switches formats.
+	if !checkOneUpd(keys, 2, verLabel, latestVal) {
+		t.Fatal()
+	}
+	if !checkOneUpd(keys, 2, latestLabel, mapVal) {
+		t.Fatal()
+	}
+}
+
+func TestUpdEvidRpc(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	if _, _, _, err := serv.Put(0, []byte{1}); err {
+		t.Fatal()
+	}
+	aud, _ := NewAuditor(sigPk)
+	audRpc := NewRpcAuditor(aud)
+	audAddr := makeUniqueAddr()
+	if audRpc.Serve(audAddr) {
+		t.Fatal()
+	}
+	defer audRpc.Close()
+	audCli, err0 := advrpc.Dial(audAddr)
+	if err0 {
+		t.Fatal()
+	}
+	ctx := context.Background()
+	p0, _ := serv.Audit(0)
+	if _, err := CallAdtrUpdate(ctx, audCli, sigPk, 0, p0); err {
+		t.Fatal()
+	}
+
+	// a forged update comes back with evid that anyone can check.
+	p1, _ := serv.Audit(1)
+	bad := forgeUpd(serv.sigSk, 1, p1.Dig, map[string][]byte{})
+	evid, err1 := CallAdtrUpdate(ctx, audCli, sigPk, 1, bad)
+	if !err1 || evid == nil || evid.Check(sigPk) {
+		t.Fatal()
+	}
+	// the evid is bound to the updates that the server vouched for.
+	evid.Updates = p1.Updates
+	if !evid.Check(sigPk) {
+		t.Fatal()
+	}
+
+	// a plain failure has no evid.
+	noSig := &UpdateProof{Updates: p1.Updates, Dig: p1.Dig, UpdSig: p1.UpdSig}
+	evid2, err2 := CallAdtrUpdate(ctx, audCli, sigPk, 1, noSig)
+	if !err2 || evid2 != nil {
+		t.Fatal()
+	}
+	// re-sending an applied update succeeds.
+	if _, err := CallAdtrUpdate(ctx, audCli, sigPk, 0, p0); err {
+		t.Fatal()
+	}
+	if _, err := CallAdtrUpdate(ctx, audCli, sigPk, 1, p1); err {
+		t.Fatal()
+	}
+}
+
+// forgeUpd is a malicious server that vouches for upd making dig at epoch.
+func forgeUpd(sk *cryptoffi.SigPrivateKey, epoch uint64, dig []byte, upd map[string][]byte) *UpdateProof {
+	pre := &PreSigDig{Epoch: epoch, Dig: dig}
+	sig := sk.Sign(PreSigDigEncode(make([]byte, 0), pre))
+	updSig := sk.Sign(preSigUpd(epoch, dig, upd))
+	return &UpdateProof{Updates: upd, Dig: dig, Sig: sig, UpdSig: updSig}
+}
+
+func TestFollow(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	defer serv.Close()
+	servCli, err0 := advrpc.Dial(servAddr)
+	if err0 {
+		t.Fatal()
+	}
+	aud, _ := NewAuditor(sigPk)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool, 1)
+	go func() {
+		_, err := aud.Follow(ctx, sigPk, servCli)
+		done <- err
+	}()
+
+	var epoch uint64
+	for uid := uint64(0); uid < 5; uid++ {
+		dig, _, _, err := serv.Put(uid, []byte{1})
+		if err {
+			t.Fatal()
+		}
+		epoch = dig.Epoch
+	}
+	// wait for the auditor to catch up.
+	var info *AdtrEpochInfo
+	var err1 = true
+	for err1 {
+		info, err1 = aud.Get(sigPk, epoch)
+		time.Sleep(time.Millisecond)
+	}
+	dig, _, _ := serv.SelfMon(0)
+	if dig.Epoch != epoch || !bytes.Equal(info.Dig, dig.Dig) {
+		t.Fatal()
+	}
+
+	// cancel ends the pending long poll.
+	cancel()
+	select {
+	case err := <-done:
+		if !err {
+			t.Fatal()
+		}
+	case <-time.After(time.Duration(auditWaitTimeout) / 2):
+		t.Fatal()
+	}
+}
+
+func TestMultiLog(t *testing.T) {
+	serv0, sigPk0, _ := NewServer()
+	serv1, sigPk1, _ := NewServer()
+	aud, audPk := NewMultiAuditor()
+	if aud.AddLog(cryptoffi.HashSuiteSha256, sigPk0) {
+		t.Fatal()
+	}
+	if aud.AddLog(cryptoffi.HashSuiteSha256, sigPk1) {
+		t.Fatal()
+	}
+	// no duplicate logs.
+	if !aud.AddLog(cryptoffi.HashSuiteSha256, sigPk0) {
+		t.Fatal()
+	}
+
+	p0, _ := serv0.Audit(0)
+	p1, _ := serv1.Audit(0)
+	// a log only takes its own server's updates.
+	if _, err := aud.Update(sigPk1, p0); !err {
+		t.Fatal()
+	}
+	if _, err := aud.Update(sigPk0, p0); err {
+		t.Fatal()
+	}
+	if _, err := aud.Update(sigPk1, p1); err {
+		t.Fatal()
+	}
+	if _, err := aud.Get([]byte{1}, 0); !err {
+		t.Fatal()
+	}
+
+	// a sig for one log doesn't verify for another.
+	info, err0 := aud.Get(sigPk0, 0)
+	if err0 {
+		t.Fatal()
+	}
+	adtrDig := &SigDig{Epoch: 0, Dig: info.Dig, Sig: info.AdtrSig}
+	if CheckAdtrSigDig(sigPk0, adtrDig, audPk) {
+		t.Fatal()
+	}
+	if !CheckAdtrSigDig(sigPk1, adtrDig, audPk) {
+		t.Fatal()
+	}
+}
+
+func TestCosignHang(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	defer serv.Close()
+	// an auditor that never answers.
+	release := make(chan struct{})
+	hang := func(arg []byte, reply *[]byte) {
+		<-release
+	}
+	h := map[uint64]func([]byte, *[]byte){AdtrUpdateRpc: hang, AdtrGetRpc: hang}
+	audRpc := advrpc.NewServer(h)
+	audAddr := makeUniqueAddr()
+	if audRpc.Serve(audAddr) {
+		t.Fatal()
+	}
+	defer audRpc.Close()
+	// unblock the handlers before Close waits on them.
+	defer close(release)
+	audCli, err0 := advrpc.Dial(audAddr)
+	if err0 {
+		t.Fatal()
+	}
+	_, audPk := NewAuditor(sigPk)
+	serv.AddCosigner(audCli, audPk)
+
+	// lookups return the prior epoch while the server waits on the auditor.
+	putDone := make(chan *SigDig, 1)
+	go func() {
+		dig, _, _, err := serv.Put(0, []byte{1})
+		if err {
+			t.Error()
+		}
+		putDone <- dig
+	}()
+	time.Sleep(time.Duration(cosignTimeout) / 2)
+	if dig, _, _, _, _ := serv.Get(0); dig.Epoch != 0 {
+		t.Fatal()
+	}
+	// the put gives up on the cosig, and then publishes the epoch.
+	select {
+	case dig := <-putDone:
+		if dig.Epoch != 1 || len(dig.Cosigs) != 0 {
+			t.Fatal()
+		}
+	case <-time.After(3 * time.Duration(cosignTimeout)):
+		t.Fatal()
+	}
+	if dig, _, _, _, _ := serv.Get(0); dig.Epoch != 1 {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,94 @@
+package kt
+
+import (
+	"crypto/subtle"
+	"sync"
+)
+
+// Authorizer decides who may look up whom, for the server's
+// Get, GetLatest, and SelfMon rpcs, and their http routes.
+// it doesn't cover Put, Audit, AuditWait, or AuditRange, which stay open.
+// caller creds are bearer tokens, so the server must take them over TLS,
+// e.g., with netffi.Opts.TLS or an https listener.
+// Client.SetCred refuses to send them otherwise.
+// it must be safe for concurrent use.
+type Authorizer interface {
+	// AuthGet errors if caller may not look up uid.
+	AuthGet(caller *Caller, uid uint64) bool
+}
+
+// authHist is like AuthGet, for lookups that carry uid's version history,
+// which only uid's owner may do. it errors on deny.
+func authHist(authz Authorizer, caller *Caller, uid uint64) bool {
+	if caller == nil || caller.Uid != uid {
+		return true
+	}
+	return authz.AuthGet(caller, uid)
+}
+
+// MemAuthz is an in-memory Authorizer.
+// it only allows callers with a registered cred, who may always look
+// up themselves. it can also limit them to their contacts,
+// and to a budget of lookups of others.
+type MemAuthz struct {
+	mu *sync.Mutex
+	// creds maps a caller uid to its cred.
+	creds map[uint64][]byte
+	// contacts, if contactsOnly, maps a caller uid to the uids it may look up.
+	contacts     map[uint64]map[uint64]bool
+	contactsOnly bool
+	// budget bounds each caller's lookups of others. 0 means no bound.
+	budget uint64
+	used   map[uint64]uint64
+}
+
+// NewMemAuthz makes a MemAuthz. if contactsOnly, callers may only look up
+// their contacts. budget bounds each caller's lookups of others,
+// with 0 meaning no bound.
+func NewMemAuthz(contactsOnly bool, budget uint64) *MemAuthz {
+	return &MemAuthz{mu: new(sync.Mutex), creds: make(map[uint64][]byte), contacts: make(map[uint64]map[uint64]bool), contactsOnly: contactsOnly, budget: budget, used: make(map[uint64]uint64)}
+}
+
+// AddCaller registers, or replaces, the cred for uid.
+func (a *MemAuthz) AddCaller(uid uint64, cred []byte) {
+	a.mu.Lock()
+	a.creds[uid] = cred
+	a.mu.Unlock()
+}
+
+// AddContact lets caller look up uid, if contactsOnly.
+func (a *MemAuthz) AddContact(caller, uid uint64) {
+	a.mu.Lock()
+	cs, ok := a.contacts[caller]
+	if !ok {
+		cs = make(map[uint64]bool)
+		a.contacts[caller] = cs
+	}
+	cs[uid] = true
+	a.mu.Unlock()
+}
+
+func (a *MemAuthz) AuthGet(caller *Caller, uid uint64) bool {
+	if caller == nil {
+		return true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cred, ok0 := a.creds[caller.Uid]
+	if !ok0 || subtle.ConstantTimeCompare(cred, caller.Cred) != 1 {
+		return true
+	}
+	if caller.Uid == uid {
+		return false
+	}
+	if a.contactsOnly && !a.contacts[caller.Uid][uid] {
+		return true
+	}
+	if a.budget != 0 {
+		if a.used[caller.Uid] >= a.budget {
+			return true
+		}
+		a.used[caller.Uid]++
+	}
+	return false
+}
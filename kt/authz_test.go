@@ -0,0 +1,172 @@
+package kt
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mit-pdos/pav/advrpc"
+	"github.com/mit-pdos/pav/cryptoffi"
+	"github.com/mit-pdos/pav/netffi"
+)
+
+func TestMemAuthz(t *testing.T) {
+	a := NewMemAuthz(true, 1)
+	a.AddCaller(0, []byte{1})
+	a.AddContact(0, 1)
+	a.AddContact(0, 2)
+	if !a.AuthGet(nil, 0) {
+		t.Fatal()
+	}
+	if !a.AuthGet(&Caller{Uid: 0, Cred: []byte{2}}, 0) {
+		t.Fatal()
+	}
+	alice := &Caller{Uid: 0, Cred: []byte{1}}
+	// self lookups are always ok, and don't use the budget.
+	if a.AuthGet(alice, 0) || a.AuthGet(alice, 0) {
+		t.Fatal()
+	}
+	// not a contact.
+	if !a.AuthGet(alice, 3) {
+		t.Fatal()
+	}
+	if a.AuthGet(alice, 1) {
+		t.Fatal()
+	}
+	// over budget.
+	if !a.AuthGet(alice, 2) {
+		t.Fatal()
+	}
+}
+
+func TestRpcAuthz(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	authz := NewMemAuthz(false, 0)
+	authz.AddCaller(0, []byte{1})
+	servRpc := NewRpcServerAuth(serv, authz)
+	servAddr := netffi.Uint64Addr(makeUniqueAddr())
+	if servRpc.ServeAddr(servAddr, &netffi.Opts{TLS: cryptoffi.TLSServerConfig(serv.sigSk)}) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	opts := &netffi.Opts{TLS: cryptoffi.TLSClientConfig(sigPk)}
+
+	alice, err0 := NewClientOpts(0, servAddr, opts, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	if _, err := alice.Put([]byte{1}); err.Err {
+		t.Fatal()
+	}
+	// no cred.
+	if _, err := alice.SelfMon(); !err.Err {
+		t.Fatal()
+	}
+	if alice.SetCred([]byte{1}) {
+		t.Fatal()
+	}
+	if _, err := alice.SelfMon(); err.Err {
+		t.Fatal()
+	}
+	if _, _, _, err := alice.GetLatest(1); err.Err {
+		t.Fatal()
+	}
+	// only the owner gets the history.
+	if _, _, _, err := alice.Get(0); err.Err {
+		t.Fatal()
+	}
+	if _, _, _, err := alice.Get(1); !err.Err {
+		t.Fatal()
+	}
+
+	// a denied caller gets Err from each gated rpc.
+	servCli, err1 := advrpc.DialAddr(servAddr, opts)
+	if err1 {
+		t.Fatal()
+	}
+	ctx := context.Background()
+	denied := &Caller{Uid: 1, Cred: []byte{1}}
+	if _, _, _, _, _, err := CallServGet(ctx, servCli, denied, 0); !err {
+		t.Fatal()
+	}
+	if _, _, _, err := CallServGetLatest(ctx, servCli, denied, 0); !err {
+		t.Fatal()
+	}
+	if _, _, _, err := CallServSelfMon(ctx, servCli, denied, 1); !err {
+		t.Fatal()
+	}
+	// the ungated rpcs still work.
+	if _, err := CallServAudit(ctx, servCli, 0); err {
+		t.Fatal()
+	}
+}
+
+func TestHttpAuthz(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	authz := NewMemAuthz(false, 0)
+	authz.AddCaller(0, []byte{1})
+	servWeb := httptest.NewTLSServer(NewHttpServerAuth(serv, authz))
+	defer servWeb.Close()
+
+	// a denied caller gets a 403 from each gated route.
+	for _, route := range []string{"get?uid=0", "getlatest?uid=0", "selfmon?uid=1"} {
+		req, err := http.NewRequest("GET", servWeb.URL+HttpPrefix+route, nil)
+		if err != nil {
+			t.Fatal()
+		}
+		req.Header.Set(HttpCallerHeader, "1")
+		req.Header.Set(HttpCredHeader, base64.StdEncoding.EncodeToString([]byte{1}))
+		resp, err0 := servWeb.Client().Do(req)
+		if err0 != nil || resp.StatusCode != http.StatusForbidden {
+			t.Fatal()
+		}
+		resp.Body.Close()
+	}
+	alice, err1 := NewHttpClient(0, servWeb.URL, servWeb.Client(), sigPk, serv.Params())
+	if err1 {
+		t.Fatal()
+	}
+	if alice.SetCred([]byte{1}) {
+		t.Fatal()
+	}
+	if _, _, _, err := alice.GetLatest(1); err.Err {
+		t.Fatal()
+	}
+	// only the owner gets the history.
+	if _, _, _, err := alice.Get(0); err.Err {
+		t.Fatal()
+	}
+	if _, _, _, err := alice.Get(1); !err.Err {
+		t.Fatal()
+	}
+}
+
+func TestCredTLS(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	servWeb := httptest.NewServer(NewHttpServer(serv))
+	defer servWeb.Close()
+
+	// creds don't go over plain conns.
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	if !alice.SetCred([]byte{1}) {
+		t.Fatal()
+	}
+	bob, err1 := NewHttpClient(1, servWeb.URL, servWeb.Client(), sigPk, serv.Params())
+	if err1 {
+		t.Fatal()
+	}
+	if !bob.SetCred([]byte{1}) {
+		t.Fatal()
+	}
+}
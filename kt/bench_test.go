@@ -81,10 +81,10 @@ func TestBenchPutGenVer(t *testing.T) {
 		}
 
 		t1 := time.Now()
-		if checkMemb(vrfPk, uid, 0, dig.Dig, lat) {
+		if checkMemb(vrfPk, serv.suite, uid, 0, dig.Dig, lat) {
 			t.Fatal()
 		}
-		if checkNonMemb(vrfPk, uid, 1, dig.Dig, bound) {
+		if checkNonMemb(vrfPk, serv.suite, uid, 1, dig.Dig, bound) {
 			t.Fatal()
 		}
 		t2 := time.Now()
@@ -184,11 +184,13 @@ func TestBenchPutSize(t *testing.T) {
 }
 
 func TestBenchPutCli(t *testing.T) {
-	serv, sigPk, vrfPk, _ := seedServer(defNSeed)
-	vrfPkB := cryptoffi.VrfPublicKeyEncode(vrfPk)
+	serv, sigPk, _, _ := seedServer(defNSeed)
 	servRpc := NewRpcServer(serv)
 	servAddr := makeUniqueAddr()
-	servRpc.Serve(servAddr)
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
 	time.Sleep(time.Millisecond)
 	nOps := 10_000
 	nWarm := getWarmup(nOps)
@@ -196,7 +198,10 @@ func TestBenchPutCli(t *testing.T) {
 	clients := make([]*Client, 0, nWarm+nOps)
 	for i := 0; i < nWarm+nOps; i++ {
 		u := rand.Uint64()
-		c := NewClient(u, servAddr, sigPk, vrfPkB)
+		c, errb := NewClient(u, servAddr, sigPk, serv.Params())
+		if errb {
+			t.Fatal()
+		}
 		clients = append(clients, c)
 	}
 
@@ -244,13 +249,13 @@ func TestBenchGetGenVer(t *testing.T) {
 		}
 
 		t1 := time.Now()
-		if checkHist(vrfPk, uid, dig.Dig, hist) {
+		if checkHist(vrfPk, serv.suite, uid, dig.Dig, hist) {
 			t.Fatal()
 		}
-		if checkMemb(vrfPk, uid, 0, dig.Dig, lat) {
+		if checkMemb(vrfPk, serv.suite, uid, 0, dig.Dig, lat) {
 			t.Fatal()
 		}
-		if checkNonMemb(vrfPk, uid, 1, dig.Dig, bound) {
+		if checkNonMemb(vrfPk, serv.suite, uid, 1, dig.Dig, bound) {
 			t.Fatal()
 		}
 		t2 := time.Now()
@@ -307,13 +312,18 @@ func TestBenchGetSize(t *testing.T) {
 }
 
 func TestBenchGetCli(t *testing.T) {
-	serv, sigPk, vrfPk, uids := seedServer(defNSeed)
-	vrfPkB := cryptoffi.VrfPublicKeyEncode(vrfPk)
+	serv, sigPk, _, uids := seedServer(defNSeed)
 	servRpc := NewRpcServer(serv)
 	servAddr := makeUniqueAddr()
-	servRpc.Serve(servAddr)
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
 	time.Sleep(time.Millisecond)
-	cli := NewClient(rand.Uint64(), servAddr, sigPk, vrfPkB)
+	cli, errb := NewClient(rand.Uint64(), servAddr, sigPk, serv.Params())
+	if errb {
+		t.Fatal()
+	}
 	nOps := 10_000
 	nWarm := getWarmup(nOps)
 
@@ -356,10 +366,10 @@ func TestBenchSelfMonGenVer(t *testing.T) {
 		uid := uids[rand.Uint64N(defNSeed)]
 
 		t0 := time.Now()
-		dig, bound := serv.SelfMon(uid)
+		dig, bound, _ := serv.SelfMon(uid)
 
 		t1 := time.Now()
-		if checkNonMemb(vrfPk, uid, 1, dig.Dig, bound) {
+		if checkNonMemb(vrfPk, serv.suite, uid, 1, dig.Dig, bound) {
 			t.Fatal()
 		}
 		t2 := time.Now()
@@ -404,8 +414,8 @@ func TestBenchSelfMonScale(t *testing.T) {
 
 func TestBenchSelfMonSize(t *testing.T) {
 	serv, _, _, uids := seedServer(defNSeed)
-	dig, bound := serv.SelfMon(uids[0])
-	p := &ServerSelfMonReply{Dig: dig, Bound: bound}
+	dig, bound, latest := serv.SelfMon(uids[0])
+	p := &ServerSelfMonReply{Dig: dig, Bound: bound, Latest: latest}
 	pb := ServerSelfMonReplyEncode(nil, p)
 	benchutil.Report(1, []*benchutil.Metric{
 		{N: float64(len(pb)), Unit: "B"},
@@ -413,11 +423,13 @@ func TestBenchSelfMonSize(t *testing.T) {
 }
 
 func TestBenchSelfMonCli(t *testing.T) {
-	serv, sigPk, vrfPk, _ := seedServer(defNSeed)
-	vrfPkB := cryptoffi.VrfPublicKeyEncode(vrfPk)
+	serv, sigPk, _, _ := seedServer(defNSeed)
 	servRpc := NewRpcServer(serv)
 	servAddr := makeUniqueAddr()
-	servRpc.Serve(servAddr)
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
 	time.Sleep(time.Millisecond)
 	nOps := 20_000
 	nWarm := getWarmup(nOps)
@@ -427,7 +439,10 @@ func TestBenchSelfMonCli(t *testing.T) {
 	wg.Add(nWarm + nOps)
 	for i := 0; i < nWarm+nOps; i++ {
 		u := rand.Uint64()
-		c := NewClient(u, servAddr, sigPk, vrfPkB)
+		c, errb := NewClient(u, servAddr, sigPk, serv.Params())
+		if errb {
+			t.Fatal()
+		}
 		clients = append(clients, c)
 		go func() {
 			_, err := c.Put(mkRandVal())
@@ -493,9 +508,9 @@ func TestBenchAuditScale(t *testing.T) {
 }
 
 func auditScaleHelper(t *testing.T, batchSz, nBatches int) (time.Duration, time.Duration) {
-	serv, _, _, _ := seedServer(defNSeed)
-	aud, _ := NewAuditor()
-	epoch := updAuditor(t, serv, aud, 0)
+	serv, sigPk, _, _ := seedServer(defNSeed)
+	aud, _ := NewAuditor(sigPk)
+	epoch := updAuditor(t, serv, sigPk, aud, 0)
 	nWarm := getWarmup(nBatches)
 
 	var totalGen time.Duration
@@ -519,7 +534,7 @@ func auditScaleHelper(t *testing.T, batchSz, nBatches int) (time.Duration, time.
 				break
 			}
 			t1 := time.Now()
-			if err = aud.Update(p); err {
+			if _, err = aud.Update(sigPk, p); err {
 				t.Fatal()
 			}
 			t2 := time.Now()
@@ -562,11 +577,13 @@ func TestBenchAuditSize(t *testing.T) {
 }
 
 func TestBenchAuditCli(t *testing.T) {
-	serv, sigPk, vrfPk, _ := seedServer(defNSeed)
-	vrfPkB := cryptoffi.VrfPublicKeyEncode(vrfPk)
+	serv, sigPk, _, _ := seedServer(defNSeed)
 	servRpc := NewRpcServer(serv)
 	servAddr := makeUniqueAddr()
-	servRpc.Serve(servAddr)
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
 	time.Sleep(time.Millisecond)
 	nOps := 10_000
 	nWarm := getWarmup(nOps)
@@ -576,7 +593,10 @@ func TestBenchAuditCli(t *testing.T) {
 	wg := new(sync.WaitGroup)
 	wg.Add(nWarm + nOps)
 	for i := 0; i < nWarm+nOps; i++ {
-		c := NewClient(rand.Uint64(), servAddr, sigPk, vrfPkB)
+		c, errb := NewClient(rand.Uint64(), servAddr, sigPk, serv.Params())
+		if errb {
+			t.Fatal()
+		}
 		clients = append(clients, c)
 
 		go func() {
@@ -589,11 +609,14 @@ func TestBenchAuditCli(t *testing.T) {
 	}
 	wg.Wait()
 
-	aud, audPk := NewAuditor()
-	updAuditor(t, serv, aud, 0)
+	aud, audPk := NewAuditor(sigPk)
+	updAuditor(t, serv, sigPk, aud, 0)
 	audRpc := NewRpcAuditor(aud)
 	audAddr := makeUniqueAddr()
-	audRpc.Serve(audAddr)
+	if audRpc.Serve(audAddr) {
+		t.Fatal()
+	}
+	defer audRpc.Close()
 	time.Sleep(time.Millisecond)
 
 	var start time.Time
@@ -645,13 +668,13 @@ func TestBenchServMem(t *testing.T) {
 	}
 }
 
-func updAuditor(t *testing.T, serv *Server, aud *Auditor, epoch uint64) uint64 {
+func updAuditor(t *testing.T, serv *Server, sigPk cryptoffi.SigPublicKey, aud *Auditor, epoch uint64) uint64 {
 	for ; ; epoch++ {
 		p, err := serv.Audit(epoch)
 		if err {
 			break
 		}
-		if err = aud.Update(p); err {
+		if _, err = aud.Update(sigPk, p); err {
 			t.Fatal()
 		}
 	}
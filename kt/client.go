@@ -1,50 +1,156 @@
 package kt
 
 import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
 	"github.com/goose-lang/std"
 	"github.com/mit-pdos/pav/advrpc"
 	"github.com/mit-pdos/pav/cryptoffi"
 	"github.com/mit-pdos/pav/merkle"
+	"github.com/mit-pdos/pav/netffi"
+)
+
+const (
+	// servPoolSz bounds the number of server conns that a Client
+	// spreads its calls over.
+	servPoolSz uint64 = 4
 )
 
+// Client is safe for concurrent use.
+// Gets run in parallel, while Puts and SelfMons, which depend on
+// the client's own key versions, run one at a time.
 type Client struct {
+	// mu protects nextVer, seenDigs, minEpoch, seenAdtrInfos, badAdtrs, nextEpoch,
+	// and the conn pools.
+	mu *sync.Mutex
+	// selfMu serializes Put and SelfMon.
+	selfMu  *sync.Mutex
 	uid     uint64
 	nextVer uint64
+	// latestPk is the pk of the latest put. selfMu protects it.
+	latestPk []byte
 	// seenDigs stores, for an epoch, if we've gotten a digest for it.
 	seenDigs map[uint64]*SigDig
+	// minEpoch is the checkpoint epoch. seenDigs before it were
+	// pruned, and digs before it get rejected.
+	minEpoch uint64
+	// seenAdtrInfos stores, for an auditor pk and epoch,
+	// the validly-signed info that we've gotten from the auditor.
+	seenAdtrInfos map[string]map[uint64]*AdtrEpochInfo
+	// badAdtrs stores the auditor pks that we have AdtrEvid against.
+	// their infos no longer vouch for anything.
+	badAdtrs map[string]bool
 	// nextEpoch bounds the entries in seenDigs.
 	// storing the next (instead of last) epoch yields a correct
 	// zero val on client init, with the downside of having to check
 	// that nextEpoch doesn't overflow.
 	nextEpoch uint64
-	servCli   *advrpc.Client
+	// servClis is a pool of server conns. it only grows once
+	// all conns have in-flight calls, which servBusy counts.
+	servClis []servConn
+	servBusy []uint64
+	// servDialing is set while a new server conn is being dialed,
+	// so that only one call at a time grows the pool.
+	servDialing bool
+	// closed is set by Close, after which no new conns get dialed.
+	closed bool
+	// adtrClis caches auditor conns, by addr.
+	adtrClis map[string]*advrpc.Client
+	// dialServ makes a new server conn, and errors on fail.
+	dialServ  func() (servConn, bool)
 	servSigPk cryptoffi.SigPublicKey
 	servVrfPk *cryptoffi.VrfPublicKey
+	// suite is the server's hash suite, from its signed params.
+	suite uint64
+	// cosignPks are the auditors whose cosigs count towards cosignThresh,
+	// the number of cosigs that each dig needs.
+	cosignPks    []cryptoffi.SigPublicKey
+	cosignThresh uint64
+	// cred authenticates our lookups to the server's Authorizer.
+	cred []byte
+	// servTLS is whether the server conns use TLS, which creds need.
+	servTLS bool
+}
+
+// servConn makes server calls over some transport, e.g., advrpc or http.
+type servConn interface {
+	close()
+	put(uid uint64, pk []byte) (*SigDig, *Memb, *NonMemb, bool)
+	get(caller *Caller, uid uint64) (*SigDig, []*MembHide, bool, *Memb, *NonMemb, bool)
+	getLatest(caller *Caller, uid uint64) (*SigDig, bool, *LatestProof, bool)
+	selfMon(caller *Caller, uid uint64) (*SigDig, *NonMemb, *LatestProof, bool)
+}
+
+type rpcServConn struct {
+	cli *advrpc.Client
+}
+
+func (c *rpcServConn) close() {
+	c.cli.Close()
+}
+
+func (c *rpcServConn) put(uid uint64, pk []byte) (*SigDig, *Memb, *NonMemb, bool) {
+	return CallServPut(context.Background(), c.cli, uid, pk)
+}
+
+func (c *rpcServConn) get(caller *Caller, uid uint64) (*SigDig, []*MembHide, bool, *Memb, *NonMemb, bool) {
+	return CallServGet(context.Background(), c.cli, caller, uid)
+}
+
+func (c *rpcServConn) getLatest(caller *Caller, uid uint64) (*SigDig, bool, *LatestProof, bool) {
+	return CallServGetLatest(context.Background(), c.cli, caller, uid)
+}
+
+func (c *rpcServConn) selfMon(caller *Caller, uid uint64) (*SigDig, *NonMemb, *LatestProof, bool) {
+	return CallServSelfMon(context.Background(), c.cli, caller, uid)
+}
+
+func dialRpcServ(addr *netffi.Addr, opts *netffi.Opts) (servConn, bool) {
+	cli, err := advrpc.DialAddr(addr, opts)
+	if err {
+		return nil, true
+	}
+	return &rpcServConn{cli: cli}, false
 }
 
 // ClientErr abstracts errors that potentially have irrefutable evidence.
 type ClientErr struct {
-	Evid *Evid
-	Err  bool
+	Evid     *Evid
+	AdtrEvid *AdtrEvid
+	Err      bool
 }
 
 // Put rets the epoch at which the key was put, and evid / error on fail.
 func (c *Client) Put(pk []byte) (uint64, *ClientErr) {
+	c.selfMu.Lock()
+	epoch, err := c.put(pk)
+	c.selfMu.Unlock()
+	return epoch, err
+}
+
+func (c *Client) put(pk []byte) (uint64, *ClientErr) {
 	stdErr := &ClientErr{Err: true}
-	dig, latest, bound, err0 := CallServPut(c.servCli, c.uid, pk)
+	idx, cli, nextVer, startEpoch := c.start()
+	dig, latest, bound, err0 := cli.put(c.uid, pk)
+	c.finish(idx)
 	if err0 {
 		return 0, stdErr
 	}
 	// dig.
-	err1 := checkDig(c.servSigPk, c.seenDigs, dig)
+	err1 := c.checkDig(dig)
 	if err1.Err {
 		return 0, err1
 	}
-	if dig.Epoch < c.nextEpoch {
+	// the put must land after all digs seen before it started.
+	if dig.Epoch < startEpoch {
 		return 0, stdErr
 	}
 	// latest.
-	if checkMemb(c.servVrfPk, c.uid, c.nextVer, dig.Dig, latest) {
+	if checkMemb(c.servVrfPk, c.suite, c.uid, nextVer, dig.Dig, latest) {
 		return 0, stdErr
 	}
 	if dig.Epoch != latest.EpochAdded {
@@ -54,13 +160,19 @@ func (c *Client) Put(pk []byte) (uint64, *ClientErr) {
 		return 0, stdErr
 	}
 	// bound.
-	if checkNonMemb(c.servVrfPk, c.uid, c.nextVer+1, dig.Dig, bound) {
+	if checkNonMemb(c.servVrfPk, c.suite, c.uid, nextVer+1, dig.Dig, bound) {
 		return 0, stdErr
 	}
-	c.seenDigs[dig.Epoch] = dig
-	c.nextEpoch = dig.Epoch + 1
+	c.mu.Lock()
+	err2 := c.addDig(dig)
+	if err2.Err {
+		c.mu.Unlock()
+		return 0, err2
+	}
 	// this client controls nextVer, so no need to check for overflow.
-	c.nextVer = std.SumAssumeNoOverflow(c.nextVer, 1)
+	c.nextVer = std.SumAssumeNoOverflow(nextVer, 1)
+	c.mu.Unlock()
+	c.latestPk = pk
 	return dig.Epoch, &ClientErr{Err: false}
 }
 
@@ -71,20 +183,23 @@ func (c *Client) Put(pk []byte) (uint64, *ClientErr) {
 // e.g., if don't check isReg alignment with hist, could have fraud non-exis key.
 func (c *Client) Get(uid uint64) (bool, []byte, uint64, *ClientErr) {
 	stdErr := &ClientErr{Err: true}
-	dig, hist, isReg, latest, bound, err0 := CallServGet(c.servCli, uid)
+	idx, cli, _, startEpoch := c.start()
+	dig, hist, isReg, latest, bound, err0 := cli.get(c.caller(), uid)
+	c.finish(idx)
 	if err0 {
 		return false, nil, 0, stdErr
 	}
 	// dig.
-	err1 := checkDig(c.servSigPk, c.seenDigs, dig)
+	err1 := c.checkDig(dig)
 	if err1.Err {
 		return false, nil, 0, err1
 	}
-	if dig.Epoch+1 < c.nextEpoch {
+	// no rollback past digs seen before the get started.
+	if dig.Epoch+1 < startEpoch {
 		return false, nil, 0, stdErr
 	}
 	// hist.
-	if checkHist(c.servVrfPk, uid, dig.Dig, hist) {
+	if checkHist(c.servVrfPk, c.suite, uid, dig.Dig, hist) {
 		return false, nil, 0, stdErr
 	}
 	numHistVers := uint64(len(hist))
@@ -92,7 +207,7 @@ func (c *Client) Get(uid uint64) (bool, []byte, uint64, *ClientErr) {
 		return false, nil, 0, stdErr
 	}
 	// latest.
-	if isReg && checkMemb(c.servVrfPk, uid, numHistVers, dig.Dig, latest) {
+	if isReg && checkMemb(c.servVrfPk, c.suite, uid, numHistVers, dig.Dig, latest) {
 		return false, nil, 0, stdErr
 	}
 	// bound.
@@ -100,56 +215,523 @@ func (c *Client) Get(uid uint64) (bool, []byte, uint64, *ClientErr) {
 	if isReg {
 		boundVer = numHistVers + 1
 	}
-	if checkNonMemb(c.servVrfPk, uid, boundVer, dig.Dig, bound) {
+	if checkNonMemb(c.servVrfPk, c.suite, uid, boundVer, dig.Dig, bound) {
 		return false, nil, 0, stdErr
 	}
-	c.seenDigs[dig.Epoch] = dig
-	c.nextEpoch = dig.Epoch + 1
+	c.mu.Lock()
+	err2 := c.addDig(dig)
+	c.mu.Unlock()
+	if err2.Err {
+		return false, nil, 0, err2
+	}
+	return isReg, latest.PkOpen.Val, dig.Epoch, &ClientErr{Err: false}
+}
+
+// GetLatest is like Get, but the server only proves uid's latest label,
+// which hides the number of versions and when the latest was added.
+// unlike Get, it relies on uid's owner to SelfMon at each epoch,
+// see Server.GetLatest.
+func (c *Client) GetLatest(uid uint64) (bool, []byte, uint64, *ClientErr) {
+	stdErr := &ClientErr{Err: true}
+	idx, cli, _, startEpoch := c.start()
+	dig, isReg, latest, err0 := cli.getLatest(c.caller(), uid)
+	c.finish(idx)
+	if err0 {
+		return false, nil, 0, stdErr
+	}
+	// dig.
+	err1 := c.checkDig(dig)
+	if err1.Err {
+		return false, nil, 0, err1
+	}
+	// no rollback past digs seen before the get started.
+	if dig.Epoch+1 < startEpoch {
+		return false, nil, 0, stdErr
+	}
+	// latest.
+	if checkLatest(c.servVrfPk, c.suite, uid, isReg, dig.Dig, latest) {
+		return false, nil, 0, stdErr
+	}
+	c.mu.Lock()
+	err2 := c.addDig(dig)
+	c.mu.Unlock()
+	if err2.Err {
+		return false, nil, 0, err2
+	}
 	return isReg, latest.PkOpen.Val, dig.Epoch, &ClientErr{Err: false}
 }
 
 // SelfMon self-monitors for the client's own key, and returns the epoch
 // through which it succeeds, or evid / error on fail.
 func (c *Client) SelfMon() (uint64, *ClientErr) {
+	c.selfMu.Lock()
+	epoch, err := c.selfMon()
+	c.selfMu.Unlock()
+	return epoch, err
+}
+
+func (c *Client) selfMon() (uint64, *ClientErr) {
 	stdErr := &ClientErr{Err: true}
-	dig, bound, err0 := CallServSelfMon(c.servCli, c.uid)
+	idx, cli, nextVer, startEpoch := c.start()
+	dig, bound, latest, err0 := cli.selfMon(c.caller(), c.uid)
+	c.finish(idx)
 	if err0 {
 		return 0, stdErr
 	}
 	// dig.
-	err1 := checkDig(c.servSigPk, c.seenDigs, dig)
+	err1 := c.checkDig(dig)
 	if err1.Err {
 		return 0, err1
 	}
-	if dig.Epoch+1 < c.nextEpoch {
+	if dig.Epoch+1 < startEpoch {
 		return 0, stdErr
 	}
 	// bound.
-	if checkNonMemb(c.servVrfPk, c.uid, c.nextVer, dig.Dig, bound) {
+	if checkNonMemb(c.servVrfPk, c.suite, c.uid, nextVer, dig.Dig, bound) {
 		return 0, stdErr
 	}
-	c.seenDigs[dig.Epoch] = dig
-	c.nextEpoch = dig.Epoch + 1
+	// latest. the label must commit to our latest pk,
+	// which the server could otherwise change behind GetLatest.
+	isReg := nextVer != 0
+	if checkLatest(c.servVrfPk, c.suite, c.uid, isReg, dig.Dig, latest) {
+		return 0, stdErr
+	}
+	if isReg && !std.BytesEqual(c.latestPk, latest.PkOpen.Val) {
+		return 0, stdErr
+	}
+	c.mu.Lock()
+	err2 := c.addDig(dig)
+	c.mu.Unlock()
+	if err2.Err {
+		return 0, err2
+	}
 	return dig.Epoch, &ClientErr{Err: false}
 }
 
+// SetCred sets the cred that the client sends with lookups,
+// for servers that restrict them. see Authorizer.
+// the cred is a bearer token, so SetCred errors, and sets nothing,
+// if the server conns don't use TLS.
+func (c *Client) SetCred(cred []byte) bool {
+	if !c.servTLS {
+		return true
+	}
+	c.mu.Lock()
+	c.cred = cred
+	c.mu.Unlock()
+	return false
+}
+
+func (c *Client) caller() *Caller {
+	c.mu.Lock()
+	cred := c.cred
+	c.mu.Unlock()
+	return &Caller{Uid: c.uid, Cred: cred}
+}
+
+// start picks the least busy server conn, and snapshots the state
+// that a call checks against. the caller must finish the conn.
+func (c *Client) start() (uint64, servConn, uint64, uint64) {
+	c.mu.Lock()
+	idx0 := c.leastBusy()
+	if c.servBusy[idx0] != 0 && uint64(len(c.servClis)) < servPoolSz && !c.servDialing && !c.closed {
+		// dial without c.mu, which would block all other calls.
+		c.servDialing = true
+		c.mu.Unlock()
+		cli, err := c.dialServ()
+		c.mu.Lock()
+		c.servDialing = false
+		// on dial fail, share a busy conn.
+		if !err {
+			c.servClis = append(c.servClis, cli)
+			c.servBusy = append(c.servBusy, 0)
+		}
+	}
+	idx := c.leastBusy()
+	c.servBusy[idx]++
+	cli := c.servClis[idx]
+	nextVer := c.nextVer
+	nextEpoch := c.nextEpoch
+	c.mu.Unlock()
+	return idx, cli, nextVer, nextEpoch
+}
+
+// leastBusy returns the conn with the fewest in-flight calls.
+// it requires c.mu.
+func (c *Client) leastBusy() uint64 {
+	var idx uint64
+	for i, busy := range c.servBusy {
+		if busy < c.servBusy[idx] {
+			idx = uint64(i)
+		}
+	}
+	return idx
+}
+
+// finish marks a call on conn idx as done.
+func (c *Client) finish(idx uint64) {
+	c.mu.Lock()
+	c.servBusy[idx]--
+	c.mu.Unlock()
+}
+
+// checkDig checks dig against the digs seen so far, and its cosigs,
+// and errors / evid on fail.
+func (c *Client) checkDig(dig *SigDig) *ClientErr {
+	c.mu.Lock()
+	err := checkDig(c.servSigPk, c.seenDigs, c.minEpoch, dig)
+	adtrPks := c.cosignPks
+	thresh := c.cosignThresh
+	c.mu.Unlock()
+	if err.Err {
+		return err
+	}
+	if checkCosigs(c.servSigPk, adtrPks, thresh, dig) {
+		return &ClientErr{Err: true}
+	}
+	return err
+}
+
+// RequireCosigs makes the client reject digs without valid cosigs
+// from at least threshold of the auditors with adtrPks.
+// this checks audit coverage inline, without contacting the auditors.
+// the server publishes an epoch without the cosigs of auditors that are
+// down, so digs get rejected while fewer than threshold are up.
+// it errors if adtrPks has duplicates or fewer than threshold pks.
+func (c *Client) RequireCosigs(adtrPks []cryptoffi.SigPublicKey, threshold uint64) bool {
+	if threshold > uint64(len(adtrPks)) {
+		return true
+	}
+	if hasDupPks(adtrPks) {
+		return true
+	}
+	c.mu.Lock()
+	c.cosignPks = adtrPks
+	c.cosignThresh = threshold
+	c.mu.Unlock()
+	return false
+}
+
+// addDig re-checks dig, since other calls might have added digs
+// in the meantime, and records it. it errors / evid on fail.
+// it requires c.mu.
+func (c *Client) addDig(dig *SigDig) *ClientErr {
+	err0 := checkDig(c.servSigPk, c.seenDigs, c.minEpoch, dig)
+	if err0.Err {
+		return err0
+	}
+	c.seenDigs[dig.Epoch] = dig
+	// concurrent calls can finish out of order,
+	// so only move nextEpoch forward.
+	if dig.Epoch >= c.nextEpoch {
+		c.nextEpoch = dig.Epoch + 1
+	}
+	return &ClientErr{Err: false}
+}
+
+// Audit checks the seen digs against the auditor at adtrAddr,
+// and errors / evid on fail.
+// it only checks the digs that the auditor hasn't already vouched for,
+// in epoch order, and it keeps the auditor conn open for later audits.
 func (c *Client) Audit(adtrAddr uint64, adtrPk cryptoffi.SigPublicKey) *ClientErr {
-	adtrCli := advrpc.Dial(adtrAddr)
-	// check all epochs that we've seen before.
-	var err0 = &ClientErr{Err: false}
+	return c.AuditAddr(netffi.Uint64Addr(adtrAddr), adtrPk)
+}
+
+// AuditAddr is like Audit, but with a general auditor addr.
+func (c *Client) AuditAddr(adtrAddr *netffi.Addr, adtrPk cryptoffi.SigPublicKey) *ClientErr {
+	adtrCli, err := c.getAdtrCli(adtrAddr)
+	if err {
+		return &ClientErr{Err: true}
+	}
+	return c.audit(func(epochs []uint64) ([]*AdtrEpochInfo, bool) {
+		// the deadline is per call, since the conn is shared.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(advrpc.DefaultTimeout))
+		defer cancel()
+		return CallAdtrGetMany(ctx, adtrCli, c.servSigPk, epochs)
+	}, adtrPk)
+}
+
+// Close closes the server conns and the cached auditor conns.
+// later calls error.
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	servClis := c.servClis
+	adtrClis := c.adtrClis
+	c.adtrClis = make(map[string]*advrpc.Client)
+	c.mu.Unlock()
+	for _, cli := range servClis {
+		cli.close()
+	}
+	for _, cli := range adtrClis {
+		cli.Close()
+	}
+}
+
+// getAdtrCli returns the cached conn to adtrAddr, dialing it if needed.
+func (c *Client) getAdtrCli(adtrAddr *netffi.Addr) (*advrpc.Client, bool) {
+	key := adtrAddr.String()
+	c.mu.Lock()
+	cli, ok := c.adtrClis[key]
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, true
+	}
+	if ok {
+		return cli, false
+	}
+	newCli, err := advrpc.DialAddr(adtrAddr, nil)
+	if err {
+		return nil, true
+	}
+	c.mu.Lock()
+	// another audit might have dialed in the meantime,
+	// or Close might have run.
+	cli0, ok0 := c.adtrClis[key]
+	closed0 := c.closed
+	if ok0 || closed0 {
+		c.mu.Unlock()
+		newCli.Close()
+		return cli0, closed0
+	}
+	c.adtrClis[key] = newCli
+	c.mu.Unlock()
+	return newCli, false
+}
+
+// audit checks seen digs against an auditor, whose digs for a batch
+// of epochs come from adtrGet.
+func (c *Client) audit(adtrGet func([]uint64) ([]*AdtrEpochInfo, bool), adtrPk cryptoffi.SigPublicKey) *ClientErr {
+	_, err := c.auditDigs(c.getSeenDigs(), adtrGet, adtrPk)
+	return err
+}
+
+// getSeenDigs returns all digs that we've seen before, in epoch order.
+func (c *Client) getSeenDigs() []*SigDig {
+	c.mu.Lock()
+	digs := c.sortedSeenDigs()
+	c.mu.Unlock()
+	return digs
+}
+
+// sortedSeenDigs is like getSeenDigs, but it requires c.mu.
+func (c *Client) sortedSeenDigs() []*SigDig {
+	digs := make([]*SigDig, 0, len(c.seenDigs))
 	for _, dig := range c.seenDigs {
-		err1 := auditEpoch(dig, c.servSigPk, adtrCli, adtrPk)
-		if err1.Err {
-			err0 = err1
+		digs = append(digs, dig)
+	}
+	slices.SortFunc(digs, func(d0, d1 *SigDig) int {
+		return cmp.Compare(d0.Epoch, d1.Epoch)
+	})
+	return digs
+}
+
+// isAudited rets whether the auditor with adtrPk already vouched for dig.
+// it requires c.mu.
+func (c *Client) isAudited(adtrPk cryptoffi.SigPublicKey, dig *SigDig) bool {
+	if c.badAdtrs[string(adtrPk)] {
+		return false
+	}
+	infos, ok0 := c.seenAdtrInfos[string(adtrPk)]
+	if !ok0 {
+		return false
+	}
+	info, ok1 := infos[dig.Epoch]
+	return ok1 && std.BytesEqual(info.Dig, dig.Dig)
+}
+
+// auditDigs checks digs against an auditor. it rets, for each dig,
+// whether the auditor vouched for it, along with evid / error on any fail.
+// it only asks the auditor about digs that it hasn't vouched for,
+// in batches of up to maxAdtrGetMany.
+func (c *Client) auditDigs(digs []*SigDig, adtrGet func([]uint64) ([]*AdtrEpochInfo, bool), adtrPk cryptoffi.SigPublicKey) ([]bool, *ClientErr) {
+	oks := make([]bool, len(digs))
+	var idxs []uint64
+	c.mu.Lock()
+	for i, dig := range digs {
+		if c.isAudited(adtrPk, dig) {
+			oks[i] = true
+		} else {
+			idxs = append(idxs, uint64(i))
+		}
+	}
+	c.mu.Unlock()
+
+	var err0 = &ClientErr{Err: false}
+	for len(idxs) != 0 {
+		var n = uint64(len(idxs))
+		if n > maxAdtrGetMany {
+			n = maxAdtrGetMany
+		}
+		batch := idxs[:n]
+		idxs = idxs[n:]
+		epochs := make([]uint64, 0, n)
+		for _, i := range batch {
+			epochs = append(epochs, digs[i].Epoch)
+		}
+		adtrInfos, err1 := adtrGet(epochs)
+		if err1 || uint64(len(adtrInfos)) != n {
+			err0 = &ClientErr{Err: true}
+			continue
+		}
+		for j, i := range batch {
+			err2 := c.auditOne(digs[i], adtrInfos[j], adtrPk)
+			if err2.Err {
+				// keep any evid we've already found.
+				if !hasEvid(err0) || hasEvid(err2) {
+					err0 = err2
+				}
+				continue
+			}
+			oks[i] = true
 		}
 	}
+	return oks, err0
+}
+
+// auditOne checks dig against an auditor's info, and records the info
+// if its sig checks out. it errors / evid on fail.
+func (c *Client) auditOne(dig *SigDig, adtrInfo *AdtrEpochInfo, adtrPk cryptoffi.SigPublicKey) *ClientErr {
+	err0 := auditEpoch(dig, c.servSigPk, adtrInfo, adtrPk)
+	// no err or server evid means that the auditor's sig checked out.
+	if err0.Err && err0.Evid == nil {
+		return err0
+	}
+	err1 := c.addAdtrInfo(adtrPk, dig.Epoch, adtrInfo)
+	if err1.Err {
+		return &ClientErr{Evid: err0.Evid, AdtrEvid: err1.AdtrEvid, Err: true}
+	}
 	return err0
 }
 
+// addAdtrInfo records an auditor's validly-signed info for epoch.
+// it errors with evid if the auditor signed a different dig before.
+func (c *Client) addAdtrInfo(adtrPk cryptoffi.SigPublicKey, epoch uint64, info *AdtrEpochInfo) *ClientErr {
+	c.mu.Lock()
+	infos, ok0 := c.seenAdtrInfos[string(adtrPk)]
+	if !ok0 {
+		infos = make(map[uint64]*AdtrEpochInfo)
+		c.seenAdtrInfos[string(adtrPk)] = infos
+	}
+	seenInfo, ok1 := infos[epoch]
+	if ok1 && !std.BytesEqual(seenInfo.Dig, info.Dig) {
+		c.badAdtrs[string(adtrPk)] = true
+		c.mu.Unlock()
+		evid := &AdtrEvid{logId: c.servSigPk, epoch: epoch, info0: seenInfo, info1: info}
+		return &ClientErr{AdtrEvid: evid, Err: true}
+	}
+	infos[epoch] = info
+	c.mu.Unlock()
+	return &ClientErr{Err: false}
+}
+
+func hasEvid(err *ClientErr) bool {
+	return err.Evid != nil || err.AdtrEvid != nil
+}
+
+// AuditPolicy says which auditors a client audits against,
+// and how many of them must vouch for each seen dig.
+type AuditPolicy struct {
+	// AdtrAddrs[i] is the addr of the auditor with pk AdtrPks[i].
+	AdtrAddrs []*netffi.Addr
+	AdtrPks   []cryptoffi.SigPublicKey
+	// Threshold is the number of auditors that must sign each seen dig.
+	// it must be between 1 and the number of auditors.
+	// the auditors must have distinct pks, so that one auditor
+	// can't count twice.
+	Threshold uint64
+	// Timeout bounds each auditor call, in nanoseconds.
+	// 0 means the advrpc default, which also caps longer timeouts.
+	Timeout uint64
+}
+
+// AuditReport is the result of AuditQuorum.
+type AuditReport struct {
+	// Err has evid / error if some seen dig wasn't vouched for by
+	// Threshold auditors, or if an auditor found evid.
+	Err *ClientErr
+	// AdtrErrs[i] is auditor i's result.
+	// an auditor with evid disagreed with a dig that we saw.
+	// an auditor with adtr evid signed conflicting digs, and its
+	// sigs don't count towards Threshold.
+	// other errors mean that it couldn't be reached or had bad sigs.
+	AdtrErrs []*ClientErr
+}
+
+// Disagreed rets the indices of auditors that disagreed with
+// a seen dig.
+func (r *AuditReport) Disagreed() []uint64 {
+	var idxs []uint64
+	for i, err := range r.AdtrErrs {
+		if err.Evid != nil {
+			idxs = append(idxs, uint64(i))
+		}
+	}
+	return idxs
+}
+
+// AuditQuorum audits seen digs against each auditor in p.
+// unlike Audit, a few auditors failing is ok, as long as
+// each seen dig is vouched for by at least p.Threshold auditors.
+// server evid from any auditor is reported, since it doesn't
+// depend on trusting the auditor.
+func (c *Client) AuditQuorum(p *AuditPolicy) *AuditReport {
+	numAdtrs := uint64(len(p.AdtrAddrs))
+	if uint64(len(p.AdtrPks)) != numAdtrs || p.Threshold == 0 || p.Threshold > numAdtrs {
+		return &AuditReport{Err: &ClientErr{Err: true}}
+	}
+	if hasDupPks(p.AdtrPks) {
+		return &AuditReport{Err: &ClientErr{Err: true}}
+	}
+	digs := c.getSeenDigs()
+	votes := make([]uint64, len(digs))
+	adtrErrs := make([]*ClientErr, 0, numAdtrs)
+	var evid *Evid
+	for i := uint64(0); i < numAdtrs; i++ {
+		adtrCli, err0 := c.getAdtrCli(p.AdtrAddrs[i])
+		if err0 {
+			adtrErrs = append(adtrErrs, &ClientErr{Err: true})
+			continue
+		}
+		// unlike CallAdtrGet, don't wait for a lagging auditor.
+		oks, err1 := c.auditDigs(digs, func(epochs []uint64) ([]*AdtrEpochInfo, bool) {
+			var ctx = context.Background()
+			if p.Timeout != 0 {
+				ctx0, cancel := context.WithTimeout(ctx, time.Duration(p.Timeout))
+				defer cancel()
+				ctx = ctx0
+			}
+			return callAdtrGetManyInner(ctx, adtrCli, c.servSigPk, epochs)
+		}, p.AdtrPks[i])
+		adtrErrs = append(adtrErrs, err1)
+		if err1.Evid != nil {
+			evid = err1.Evid
+		}
+		if err1.AdtrEvid != nil {
+			continue
+		}
+		for j, ok := range oks {
+			if ok {
+				votes[j]++
+			}
+		}
+	}
+
+	if evid != nil {
+		return &AuditReport{Err: &ClientErr{Evid: evid, Err: true}, AdtrErrs: adtrErrs}
+	}
+	for _, n := range votes {
+		if n < p.Threshold {
+			return &AuditReport{Err: &ClientErr{Err: true}, AdtrErrs: adtrErrs}
+		}
+	}
+	return &AuditReport{Err: &ClientErr{Err: false}, AdtrErrs: adtrErrs}
+}
+
 // auditEpoch checks a single epoch against an auditor, and evid / error on fail.
-func auditEpoch(seenDig *SigDig, servSigPk []byte, adtrCli *advrpc.Client, adtrPk cryptoffi.SigPublicKey) *ClientErr {
+func auditEpoch(seenDig *SigDig, servSigPk []byte, adtrInfo *AdtrEpochInfo, adtrPk cryptoffi.SigPublicKey) *ClientErr {
 	stdErr := &ClientErr{Err: true}
-	adtrInfo := CallAdtrGet(adtrCli, seenDig.Epoch)
 
 	// check sigs.
 	servDig := &SigDig{Epoch: seenDig.Epoch, Dig: adtrInfo.Dig, Sig: adtrInfo.ServSig}
@@ -157,7 +739,7 @@ func auditEpoch(seenDig *SigDig, servSigPk []byte, adtrCli *advrpc.Client, adtrP
 	if CheckSigDig(servDig, servSigPk) {
 		return stdErr
 	}
-	if CheckSigDig(adtrDig, adtrPk) {
+	if CheckAdtrSigDig(servSigPk, adtrDig, adtrPk) {
 		return stdErr
 	}
 
@@ -169,14 +751,49 @@ func auditEpoch(seenDig *SigDig, servSigPk []byte, adtrCli *advrpc.Client, adtrP
 	return &ClientErr{Err: false}
 }
 
-func NewClient(uid, servAddr uint64, servSigPk cryptoffi.SigPublicKey, servVrfPk []byte) *Client {
-	c := advrpc.Dial(servAddr)
-	pk := cryptoffi.VrfPublicKeyDecode(servVrfPk)
+// NewClient errors if servParams aren't signed by servSigPk
+// or have an unknown hash suite.
+func NewClient(uid, servAddr uint64, servSigPk cryptoffi.SigPublicKey, servParams *SigParams) (*Client, bool) {
+	return NewClientAddr(uid, netffi.Uint64Addr(servAddr), servSigPk, servParams)
+}
+
+// NewClientAddr is like NewClient, but with a general server addr.
+func NewClientAddr(uid uint64, servAddr *netffi.Addr, servSigPk cryptoffi.SigPublicKey, servParams *SigParams) (*Client, bool) {
+	return NewClientOpts(uid, servAddr, nil, servSigPk, servParams)
+}
+
+// NewClientOpts is like NewClientAddr, but with server transport opts,
+// e.g., for TLS.
+func NewClientOpts(uid uint64, servAddr *netffi.Addr, opts *netffi.Opts, servSigPk cryptoffi.SigPublicKey, servParams *SigParams) (*Client, bool) {
+	servTLS := opts != nil && opts.TLS != nil
+	return newClient(uid, func() (servConn, bool) {
+		return dialRpcServ(servAddr, opts)
+	}, servTLS, servSigPk, servParams)
+}
+
+func newClient(uid uint64, dialServ func() (servConn, bool), servTLS bool, servSigPk cryptoffi.SigPublicKey, servParams *SigParams) (*Client, bool) {
+	if CheckSigParams(servParams, servSigPk) {
+		return nil, true
+	}
+	if !std.BytesEqual(servParams.SigPk, servSigPk) {
+		return nil, true
+	}
+	if cryptoffi.CheckHashSuite(servParams.HashSuite) {
+		return nil, true
+	}
+	cli, err := dialServ()
+	if err {
+		return nil, true
+	}
+	clis := make([]servConn, 0, servPoolSz)
+	clis = append(clis, cli)
+	busy := make([]uint64, 1, servPoolSz)
+	pk := cryptoffi.VrfPublicKeyDecode(servParams.VrfPk)
 	digs := make(map[uint64]*SigDig)
-	return &Client{uid: uid, servCli: c, servSigPk: servSigPk, servVrfPk: pk, seenDigs: digs}
+	return &Client{mu: new(sync.Mutex), selfMu: new(sync.Mutex), uid: uid, servClis: clis, servBusy: busy, dialServ: dialServ, servSigPk: servSigPk, servVrfPk: pk, suite: servParams.HashSuite, seenDigs: digs, seenAdtrInfos: make(map[string]map[uint64]*AdtrEpochInfo), badAdtrs: make(map[string]bool), adtrClis: make(map[string]*advrpc.Client), servTLS: servTLS}, false
 }
 
-func checkDig(servSigPk []byte, seenDigs map[uint64]*SigDig, dig *SigDig) *ClientErr {
+func checkDig(servSigPk []byte, seenDigs map[uint64]*SigDig, minEpoch uint64, dig *SigDig) *ClientErr {
 	stdErr := &ClientErr{Err: true}
 	// sig.
 	err0 := CheckSigDig(dig, servSigPk)
@@ -187,6 +804,10 @@ func checkDig(servSigPk []byte, seenDigs map[uint64]*SigDig, dig *SigDig) *Clien
 	if !std.SumNoOverflow(dig.Epoch, 1) {
 		return stdErr
 	}
+	// we can't check digs that were pruned.
+	if dig.Epoch < minEpoch {
+		return stdErr
+	}
 	// agrees with prior digs.
 	seenDig, ok0 := seenDigs[dig.Epoch]
 	if ok0 && !std.BytesEqual(seenDig.Dig, dig.Dig) {
@@ -196,6 +817,84 @@ func checkDig(servSigPk []byte, seenDigs map[uint64]*SigDig, dig *SigDig) *Clien
 	return &ClientErr{Err: false}
 }
 
+// Checkpoint prunes the seen digs that at least threshold of the auditors
+// with adtrPks vouched for in prior audits, bounding client memory.
+// the latest such dig, whose epoch it rets, stands in for the pruned ones.
+// digs from before it get rejected, since we can't check them for
+// equivocation, whereas the auditors can, for the epochs that they vouched for.
+// auditors that we have AdtrEvid against don't count.
+// it errors if adtrPks has duplicates or fewer than threshold pks,
+// or if the next unpruned dig isn't vouched for.
+func (c *Client) Checkpoint(adtrPks []cryptoffi.SigPublicKey, threshold uint64) (uint64, bool) {
+	if threshold == 0 || threshold > uint64(len(adtrPks)) {
+		return 0, true
+	}
+	if hasDupPks(adtrPks) {
+		return 0, true
+	}
+	c.mu.Lock()
+	digs := c.sortedSeenDigs()
+	var ckpt *SigDig
+	for _, dig := range digs {
+		var n uint64
+		for _, pk := range adtrPks {
+			if c.isAudited(pk, dig) {
+				n++
+			}
+		}
+		if n < threshold {
+			break
+		}
+		ckpt = dig
+	}
+	if ckpt == nil {
+		c.mu.Unlock()
+		return 0, true
+	}
+	for _, dig := range digs {
+		if dig.Epoch >= ckpt.Epoch {
+			break
+		}
+		delete(c.seenDigs, dig.Epoch)
+		for _, infos := range c.seenAdtrInfos {
+			delete(infos, dig.Epoch)
+		}
+	}
+	c.minEpoch = ckpt.Epoch
+	c.mu.Unlock()
+	return ckpt.Epoch, false
+}
+
+func hasDupPks(pks []cryptoffi.SigPublicKey) bool {
+	for i, pk0 := range pks {
+		for _, pk1 := range pks[:i] {
+			if std.BytesEqual(pk0, pk1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkCosigs errors if dig doesn't have valid cosigs from at least
+// threshold of the distinct auditors with adtrPks.
+func checkCosigs(servSigPk []byte, adtrPks []cryptoffi.SigPublicKey, threshold uint64, dig *SigDig) bool {
+	var n uint64
+	for _, pk := range adtrPks {
+		for _, cosig := range dig.Cosigs {
+			if !std.BytesEqual(cosig.AdtrPk, pk) {
+				continue
+			}
+			adtrDig := &SigDig{Epoch: dig.Epoch, Dig: dig.Dig, Sig: cosig.Sig}
+			if !CheckAdtrSigDig(servSigPk, adtrDig, pk) {
+				n++
+				break
+			}
+		}
+	}
+	return n < threshold
+}
+
 // checkLabel checks the vrf proof, computes the label, and errors on fail.
 func checkLabel(servVrfPk *cryptoffi.VrfPublicKey, uid, ver uint64, proof []byte) ([]byte, bool) {
 	pre := &MapLabelPre{Uid: uid, Ver: ver}
@@ -204,29 +903,29 @@ func checkLabel(servVrfPk *cryptoffi.VrfPublicKey, uid, ver uint64, proof []byte
 }
 
 // checkMemb errors on fail.
-func checkMemb(servVrfPk *cryptoffi.VrfPublicKey, uid, ver uint64, dig []byte, memb *Memb) bool {
+func checkMemb(servVrfPk *cryptoffi.VrfPublicKey, suite, uid, ver uint64, dig []byte, memb *Memb) bool {
 	label, err := checkLabel(servVrfPk, uid, ver, memb.LabelProof)
 	if err {
 		return true
 	}
-	mapVal := compMapVal(memb.EpochAdded, memb.PkOpen)
-	return merkle.Verify(true, label, mapVal, memb.MerkleProof, dig)
+	mapVal := compMapVal(suite, memb.EpochAdded, memb.PkOpen)
+	return merkle.VerifySuite(suite, true, label, mapVal, memb.MerkleProof, dig)
 }
 
 // checkMembHide errors on fail.
-func checkMembHide(servVrfPk *cryptoffi.VrfPublicKey, uid, ver uint64, dig []byte, memb *MembHide) bool {
+func checkMembHide(servVrfPk *cryptoffi.VrfPublicKey, suite, uid, ver uint64, dig []byte, memb *MembHide) bool {
 	label, err := checkLabel(servVrfPk, uid, ver, memb.LabelProof)
 	if err {
 		return true
 	}
-	return merkle.Verify(true, label, memb.MapVal, memb.MerkleProof, dig)
+	return merkle.VerifySuite(suite, true, label, memb.MapVal, memb.MerkleProof, dig)
 }
 
 // checkHist errors on fail.
-func checkHist(servVrfPk *cryptoffi.VrfPublicKey, uid uint64, dig []byte, membs []*MembHide) bool {
+func checkHist(servVrfPk *cryptoffi.VrfPublicKey, suite, uid uint64, dig []byte, membs []*MembHide) bool {
 	var err0 bool
 	for ver, memb := range membs {
-		if checkMembHide(servVrfPk, uid, uint64(ver), dig, memb) {
+		if checkMembHide(servVrfPk, suite, uid, uint64(ver), dig, memb) {
 			err0 = true
 		}
 	}
@@ -234,10 +933,32 @@ func checkHist(servVrfPk *cryptoffi.VrfPublicKey, uid uint64, dig []byte, membs
 }
 
 // checkNonMemb errors on fail.
-func checkNonMemb(servVrfPk *cryptoffi.VrfPublicKey, uid, ver uint64, dig []byte, nonMemb *NonMemb) bool {
+func checkNonMemb(servVrfPk *cryptoffi.VrfPublicKey, suite, uid, ver uint64, dig []byte, nonMemb *NonMemb) bool {
 	label, err := checkLabel(servVrfPk, uid, ver, nonMemb.LabelProof)
 	if err {
 		return true
 	}
-	return merkle.Verify(false, label, nil, nonMemb.MerkleProof, dig)
+	return merkle.VerifySuite(suite, false, label, nil, nonMemb.MerkleProof, dig)
+}
+
+// checkLatestLabel checks the vrf proof, computes uid's latest label,
+// and errors on fail.
+func checkLatestLabel(servVrfPk *cryptoffi.VrfPublicKey, uid uint64, proof []byte) ([]byte, bool) {
+	pre := &MapLatestLabelPre{Uid: uid}
+	preByt := MapLatestLabelPreEncode(make([]byte, 0, 8), pre)
+	return servVrfPk.Verify(preByt, proof)
+}
+
+// checkLatest checks that uid's latest label is in the map iff isReg,
+// and errors on fail.
+func checkLatest(servVrfPk *cryptoffi.VrfPublicKey, suite, uid uint64, isReg bool, dig []byte, latest *LatestProof) bool {
+	label, err := checkLatestLabel(servVrfPk, uid, latest.LabelProof)
+	if err {
+		return true
+	}
+	if !isReg {
+		return merkle.VerifySuite(suite, false, label, nil, latest.MerkleProof, dig)
+	}
+	mapVal := compLatestVal(suite, latest.PkOpen)
+	return merkle.VerifySuite(suite, true, label, mapVal, latest.MerkleProof, dig)
 }
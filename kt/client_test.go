@@ -0,0 +1,575 @@
+package kt
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/mit-pdos/pav/advrpc"
+	"github.com/mit-pdos/pav/cryptoffi"
+	"github.com/mit-pdos/pav/netffi"
+)
+
+func TestGetLatest(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	bob, err1 := NewClient(1, servAddr, sigPk, serv.Params())
+	if err1 {
+		t.Fatal()
+	}
+
+	isReg0, _, _, err2 := bob.GetLatest(0)
+	if err2.Err || isReg0 {
+		t.Fatal()
+	}
+	for i := byte(0); i < 3; i++ {
+		if _, err := alice.Put([]byte{i}); err.Err {
+			t.Fatal()
+		}
+	}
+	isReg1, pk, _, err3 := bob.GetLatest(0)
+	if err3.Err || !isReg1 || !bytes.Equal(pk, []byte{2}) {
+		t.Fatal()
+	}
+
+	// the latest label proves the latest pk, without a version.
+	dig, isReg2, latest := serv.GetLatest(0)
+	if !isReg2 || checkLatest(bob.servVrfPk, bob.suite, 0, true, dig.Dig, latest) {
+		t.Fatal()
+	}
+	// the server can't serve an old pk, or deny the uid.
+	old := &LatestProof{LabelProof: latest.LabelProof, PkOpen: &CommitOpen{Val: []byte{1}, Rand: latest.PkOpen.Rand}, MerkleProof: latest.MerkleProof}
+	if !checkLatest(bob.servVrfPk, bob.suite, 0, true, dig.Dig, old) {
+		t.Fatal()
+	}
+	if !checkLatest(bob.servVrfPk, bob.suite, 0, false, dig.Dig, latest) {
+		t.Fatal()
+	}
+	// nor pass off another uid's label.
+	if !checkLatest(bob.servVrfPk, bob.suite, 1, true, dig.Dig, latest) {
+		t.Fatal()
+	}
+
+	// without an Authorizer, Get's history stays open to others.
+	isReg2, pk2, _, err4 := bob.Get(0)
+	if err4.Err || !isReg2 || !bytes.Equal(pk2, []byte{2}) {
+		t.Fatal()
+	}
+	_, hist, _, _, _ := serv.Get(0)
+	if len(hist) != 2 {
+		t.Fatal()
+	}
+
+	// the owner's SelfMon catches the server changing the latest label.
+	if _, err := alice.SelfMon(); err.Err {
+		t.Fatal()
+	}
+	forgeLatest(serv, 0, []byte{9})
+	isReg3, pk3, _, err5 := bob.GetLatest(0)
+	if err5.Err || !isReg3 || !bytes.Equal(pk3, []byte{9}) {
+		t.Fatal()
+	}
+	if _, err := alice.SelfMon(); !err.Err {
+		t.Fatal()
+	}
+}
+
+// forgeLatest is a malicious server that, in a new epoch,
+// re-commits uid's latest label to pk, without adding a version.
+func forgeLatest(s *Server, uid uint64, pk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.userInfo[uid]
+	label, _ := compLatestLabel(uid, s.vrfSk)
+	verLabel, _ := compMapLabel(uid, user.numVers-1, s.vrfSk)
+	r := compLatestRand(s.suite, s.commitSecret, label, verLabel)
+	val := compLatestVal(s.suite, &CommitOpen{Val: pk, Rand: r})
+	keyMap := s.keyMap.Clone()
+	if keyMap.PutBatch([][]byte{label}, [][]byte{val}) {
+		panic("forgeLatest")
+	}
+	info, err := s.signEpoch(keyMap, map[string][]byte{string(label): val})
+	if err {
+		panic("forgeLatest")
+	}
+	user.plainPk = pk
+	s.addEpoch(keyMap, info)
+}
+
+func TestDeadServ(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	if _, err := alice.Put([]byte{0}); err.Err {
+		t.Fatal()
+	}
+	servRpc.Close()
+
+	// the bounded retries give up, instead of looping forever.
+	_, _, _, err1 := alice.Get(0)
+	if !err1.Err {
+		t.Fatal()
+	}
+
+	// a done ctx stops the call helpers, even with a live server.
+	serv1, _, _ := NewServer()
+	servRpc1 := NewRpcServer(serv1)
+	servAddr1 := makeUniqueAddr()
+	if servRpc1.Serve(servAddr1) {
+		t.Fatal()
+	}
+	defer servRpc1.Close()
+	servCli, err2 := advrpc.Dial(servAddr1)
+	if err2 {
+		t.Fatal()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, _, _, err := CallServGet(ctx, servCli, &Caller{}, 0); !err {
+		t.Fatal()
+	}
+}
+
+func TestClientConcur(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+
+	// gets grow the conn pool while puts and selfmons run.
+	nOps := 10
+	errs := make(chan bool, 4*nOps)
+	var wg sync.WaitGroup
+	for i := 0; i < nOps; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := alice.Put([]byte{byte(i)})
+			errs <- err.Err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := alice.SelfMon()
+			errs <- err.Err
+		}()
+		go func() {
+			defer wg.Done()
+			_, _, _, err := alice.Get(1)
+			errs <- err.Err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err {
+			t.Fatal()
+		}
+	}
+	alice.mu.Lock()
+	nConns := uint64(len(alice.servClis))
+	alice.mu.Unlock()
+	if nConns > servPoolSz {
+		t.Fatal()
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	if _, err := alice.Put([]byte{1}); err.Err {
+		t.Fatal()
+	}
+	aud, audPk := NewAuditor(sigPk)
+	updAuditor(t, serv, sigPk, aud, 0)
+	audRpc := NewRpcAuditor(aud)
+	audAddr := makeUniqueAddr()
+	if audRpc.Serve(audAddr) {
+		t.Fatal()
+	}
+	defer audRpc.Close()
+
+	// a short quorum timeout doesn't stick to the shared auditor conn.
+	policy := &AuditPolicy{AdtrAddrs: []*netffi.Addr{netffi.Uint64Addr(audAddr)}, AdtrPks: []cryptoffi.SigPublicKey{audPk}, Threshold: 1, Timeout: 1}
+	if !alice.AuditQuorum(policy).Err.Err {
+		t.Fatal()
+	}
+	if alice.Audit(audAddr, audPk).Err {
+		t.Fatal()
+	}
+
+	// calls after Close error, instead of redialing.
+	alice.Close()
+	if _, _, _, err := alice.Get(0); !err.Err {
+		t.Fatal()
+	}
+	if !alice.AuditQuorum(policy).Err.Err {
+		t.Fatal()
+	}
+	if !alice.Audit(audAddr, audPk).Err {
+		t.Fatal()
+	}
+}
+
+func TestAuditQuorum(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	cli, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	if _, err := cli.Put([]byte{1}); err.Err {
+		t.Fatal()
+	}
+
+	// the last auditor doesn't get any updates.
+	policy := &AuditPolicy{}
+	for i := 0; i < 3; i++ {
+		aud, audPk := NewAuditor(sigPk)
+		if i < 2 {
+			updAuditor(t, serv, sigPk, aud, 0)
+		}
+		audRpc := NewRpcAuditor(aud)
+		audAddr := makeUniqueAddr()
+		if audRpc.Serve(audAddr) {
+			t.Fatal()
+		}
+		defer audRpc.Close()
+		policy.AdtrAddrs = append(policy.AdtrAddrs, netffi.Uint64Addr(audAddr))
+		policy.AdtrPks = append(policy.AdtrPks, audPk)
+	}
+
+	policy.Threshold = 2
+	rep0 := cli.AuditQuorum(policy)
+	if rep0.Err.Err || len(rep0.AdtrErrs) != 3 {
+		t.Fatal()
+	}
+	if rep0.AdtrErrs[0].Err || rep0.AdtrErrs[1].Err || !rep0.AdtrErrs[2].Err {
+		t.Fatal()
+	}
+	// a lagging auditor didn't disagree.
+	if len(rep0.Disagreed()) != 0 {
+		t.Fatal()
+	}
+	policy.Threshold = 3
+	if !cli.AuditQuorum(policy).Err.Err {
+		t.Fatal()
+	}
+	policy.Threshold = 0
+	if !cli.AuditQuorum(policy).Err.Err {
+		t.Fatal()
+	}
+
+	// an auditor listed twice doesn't count twice.
+	dup := &AuditPolicy{
+		AdtrAddrs: []*netffi.Addr{policy.AdtrAddrs[0], policy.AdtrAddrs[0], policy.AdtrAddrs[2]},
+		AdtrPks:   []cryptoffi.SigPublicKey{policy.AdtrPks[0], policy.AdtrPks[0], policy.AdtrPks[2]},
+		Threshold: 2,
+	}
+	if !cli.AuditQuorum(dup).Err.Err {
+		t.Fatal()
+	}
+}
+
+func TestCosign(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	var adtrPks []cryptoffi.SigPublicKey
+	for i := 0; i < 2; i++ {
+		aud, audPk := NewAuditor(sigPk)
+		audRpc := NewRpcAuditor(aud)
+		audAddr := makeUniqueAddr()
+		if audRpc.Serve(audAddr) {
+			t.Fatal()
+		}
+		defer audRpc.Close()
+		audCli, err := advrpc.Dial(audAddr)
+		if err {
+			t.Fatal()
+		}
+		serv.AddCosigner(audCli, audPk)
+		adtrPks = append(adtrPks, audPk)
+	}
+
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	if !alice.RequireCosigs(adtrPks, 3) {
+		t.Fatal()
+	}
+	if alice.RequireCosigs(adtrPks, 2) {
+		t.Fatal()
+	}
+	if _, err := alice.Put([]byte{1}); err.Err {
+		t.Fatal()
+	}
+	if _, err := alice.SelfMon(); err.Err {
+		t.Fatal()
+	}
+
+	// lookups only see cosigned epochs, even during puts.
+	carol, err2 := NewClient(2, servAddr, sigPk, serv.Params())
+	if err2 {
+		t.Fatal()
+	}
+	if carol.RequireCosigs(adtrPks, 2) {
+		t.Fatal()
+	}
+	putsDone := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			if _, err := alice.Put([]byte{1}); err.Err {
+				t.Error()
+			}
+		}
+		close(putsDone)
+	}()
+	for done := false; !done; {
+		select {
+		case <-putsDone:
+			done = true
+		default:
+		}
+		if _, _, _, err := carol.Get(0); err.Err {
+			t.Fatal()
+		}
+	}
+
+	// a client that needs a non-cosigning auditor rejects digs.
+	_, otherPk := NewAuditor(sigPk)
+	bob, err1 := NewClient(1, servAddr, sigPk, serv.Params())
+	if err1 {
+		t.Fatal()
+	}
+	if !bob.RequireCosigs([]cryptoffi.SigPublicKey{adtrPks[0], adtrPks[0]}, 1) {
+		t.Fatal()
+	}
+	if bob.RequireCosigs([]cryptoffi.SigPublicKey{adtrPks[0], otherPk}, 2) {
+		t.Fatal()
+	}
+	if _, _, _, err := bob.Get(0); !err.Err {
+		t.Fatal()
+	}
+	if bob.RequireCosigs([]cryptoffi.SigPublicKey{adtrPks[0], otherPk}, 1) {
+		t.Fatal()
+	}
+	if _, _, _, err := bob.Get(0); err.Err {
+		t.Fatal()
+	}
+}
+
+func TestAdtrEvid(t *testing.T) {
+	serv0, sigPk, _ := NewServer()
+	serv1, _, _ := NewServer()
+	// serv1 signs as serv0, so both auditors below accept its epochs.
+	// the init epochs have the same empty dig.
+	serv1.sigSk = serv0.sigSk
+	serv1.epochHist[0].sig = serv0.epochHist[0].sig
+	serv1.epochHist[0].updSig = serv0.epochHist[0].updSig
+	if _, _, _, err := serv0.Put(0, []byte{1}); err {
+		t.Fatal()
+	}
+	if _, _, _, err := serv1.Put(0, []byte{2}); err {
+		t.Fatal()
+	}
+	// the same auditor key signs both histories.
+	aud0, audPk := NewAuditor(sigPk)
+	aud1, _ := NewAuditor(sigPk)
+	aud1.sk = aud0.sk
+	updAuditor(t, serv0, sigPk, aud0, 0)
+	updAuditor(t, serv1, sigPk, aud1, 0)
+
+	servRpc := NewRpcServer(serv0)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	alice, err0 := NewClient(1, servAddr, sigPk, serv0.Params())
+	if err0 {
+		t.Fatal()
+	}
+	if _, err := alice.SelfMon(); err.Err {
+		t.Fatal()
+	}
+
+	adtrGet := func(aud *Auditor) func([]uint64) ([]*AdtrEpochInfo, bool) {
+		return func(epochs []uint64) ([]*AdtrEpochInfo, bool) {
+			return aud.GetMany(sigPk, epochs)
+		}
+	}
+	// aud1 vouches for serv1's dig, which conflicts with what alice saw.
+	err1 := alice.audit(adtrGet(aud1), audPk)
+	if !err1.Err || err1.Evid == nil || err1.AdtrEvid != nil {
+		t.Fatal()
+	}
+	if err1.Evid.Check(sigPk) {
+		t.Fatal()
+	}
+	// the same auditor key later vouches for serv0's dig.
+	err2 := alice.audit(adtrGet(aud0), audPk)
+	if !err2.Err || err2.AdtrEvid == nil {
+		t.Fatal()
+	}
+	if err2.AdtrEvid.Check(audPk) {
+		t.Fatal()
+	}
+	// evid doesn't check for another auditor.
+	_, otherPk := NewAuditor(sigPk)
+	if !err2.AdtrEvid.Check(otherPk) {
+		t.Fatal()
+	}
+
+}
+
+func TestAuditIncr(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := alice.Put([]byte{1}); err.Err {
+			t.Fatal()
+		}
+	}
+
+	aud, audPk := NewAuditor(sigPk)
+	updAuditor(t, serv, sigPk, aud, 0)
+	audRpc := NewRpcAuditor(aud)
+	audAddr := makeUniqueAddr()
+	if audRpc.Serve(audAddr) {
+		t.Fatal()
+	}
+	if alice.Audit(audAddr, audPk).Err {
+		t.Fatal()
+	}
+	// all seen digs are audited, so the auditor isn't needed.
+	audRpc.Close()
+	if alice.Audit(audAddr, audPk).Err {
+		t.Fatal()
+	}
+
+	if _, err := aud.GetMany(sigPk, make([]uint64, maxAdtrGetMany+1)); !err {
+		t.Fatal()
+	}
+	if _, err := aud.GetMany(sigPk, []uint64{0, 100}); !err {
+		t.Fatal()
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servRpc := NewRpcServer(serv)
+	servAddr := makeUniqueAddr()
+	if servRpc.Serve(servAddr) {
+		t.Fatal()
+	}
+	defer servRpc.Close()
+	alice, err0 := NewClient(0, servAddr, sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	var oldDig *SigDig
+	for i := 0; i < 3; i++ {
+		if _, err := alice.Put([]byte{1}); err.Err {
+			t.Fatal()
+		}
+		if oldDig == nil {
+			oldDig, _, _ = serv.SelfMon(0)
+		}
+	}
+
+	aud, audPk := NewAuditor(sigPk)
+	updAuditor(t, serv, sigPk, aud, 0)
+	adtrPks := []cryptoffi.SigPublicKey{audPk}
+	// nothing is audited yet.
+	if _, err := alice.Checkpoint(adtrPks, 1); !err {
+		t.Fatal()
+	}
+	audRpc := NewRpcAuditor(aud)
+	audAddr := makeUniqueAddr()
+	if audRpc.Serve(audAddr) {
+		t.Fatal()
+	}
+	defer audRpc.Close()
+	if alice.Audit(audAddr, audPk).Err {
+		t.Fatal()
+	}
+	if _, err := alice.Checkpoint(adtrPks, 2); !err {
+		t.Fatal()
+	}
+	ckpt, err1 := alice.Checkpoint(adtrPks, 1)
+	if err1 || ckpt != oldDig.Epoch+2 || len(alice.seenDigs) != 1 {
+		t.Fatal()
+	}
+
+	// pruned digs get rejected, while later ones still work.
+	if !alice.checkDig(oldDig).Err {
+		t.Fatal()
+	}
+	if _, err := alice.SelfMon(); err.Err {
+		t.Fatal()
+	}
+	if alice.Audit(audAddr, audPk).Err {
+		t.Fatal()
+	}
+
+	// an auditor caught equivocating no longer counts.
+	bad := &AdtrEpochInfo{Dig: []byte{0}}
+	if err := alice.addAdtrInfo(audPk, ckpt, bad); err.AdtrEvid == nil {
+		t.Fatal()
+	}
+	if _, err := alice.Checkpoint(adtrPks, 1); !err {
+		t.Fatal()
+	}
+}
@@ -1,8 +1,12 @@
 package kt
 
 import (
+	"slices"
+
 	"github.com/goose-lang/std"
 	"github.com/mit-pdos/pav/cryptoffi"
+	"github.com/mit-pdos/pav/marshalutil"
+	"github.com/tchajed/marshal"
 )
 
 // Check rets err if signed dig does not validate.
@@ -12,12 +16,65 @@ func CheckSigDig(o *SigDig, pk cryptoffi.SigPublicKey) bool {
 	return pk.Verify(preByt, o.Sig)
 }
 
+// CheckAdtrSigDig rets err if an auditor's signed dig for logId
+// does not validate.
+func CheckAdtrSigDig(logId []byte, o *SigDig, pk cryptoffi.SigPublicKey) bool {
+	pre := &PreSigAdtrDig{LogId: logId, Epoch: o.Epoch, Dig: o.Dig}
+	preByt := PreSigAdtrDigEncode(make([]byte, 0), pre)
+	return pk.Verify(preByt, o.Sig)
+}
+
+// CheckUpdSig rets err if the server's sig vouching that upd
+// makes dig at epoch does not validate.
+func CheckUpdSig(epoch uint64, dig []byte, upd map[string][]byte, sig []byte, pk cryptoffi.SigPublicKey) bool {
+	return pk.Verify(preSigUpd(epoch, dig, upd), sig)
+}
+
+// preSigUpd is what the server signs to vouch that upd makes dig at epoch.
+// it sorts upd, so the encoding doesn't depend on map order.
+// with a HashLen dig, it's always longer than a PreSigDig,
+// so an upd sig can't pose as a dig sig.
+func preSigUpd(epoch uint64, dig []byte, upd map[string][]byte) []byte {
+	labels := make([]string, 0, len(upd))
+	var sz = uint64(8 + 8 + len(dig) + 8)
+	for label, val := range upd {
+		labels = append(labels, label)
+		sz += uint64(8 + len(label) + 8 + len(val))
+	}
+	slices.Sort(labels)
+	var b = make([]byte, 0, sz)
+	b = marshal.WriteInt(b, epoch)
+	b = marshalutil.WriteSlice1D(b, dig)
+	b = marshal.WriteInt(b, uint64(len(labels)))
+	for _, label := range labels {
+		b = marshalutil.WriteSlice1D(b, []byte(label))
+		b = marshalutil.WriteSlice1D(b, upd[label])
+	}
+	return b
+}
+
+// CheckSigParams rets err if signed params do not validate.
+func CheckSigParams(o *SigParams, pk cryptoffi.SigPublicKey) bool {
+	pre := &PreSigParams{HashSuite: o.HashSuite, VrfPk: o.VrfPk, SigPk: o.SigPk}
+	preByt := PreSigParamsEncode(make([]byte, 0), pre)
+	return pk.Verify(preByt, o.Sig)
+}
+
 // Evid is evidence that the server signed two conflicting digs.
 type Evid struct {
 	sigDig0 *SigDig
 	sigDig1 *SigDig
 }
 
+// AdtrEvid is evidence that an auditor signed two conflicting digs
+// for the same log and epoch.
+type AdtrEvid struct {
+	logId []byte
+	epoch uint64
+	info0 *AdtrEpochInfo
+	info1 *AdtrEpochInfo
+}
+
 // Check returns an error if the evidence does not check out.
 // otherwise, it proves that the server was dishonest.
 func (e *Evid) Check(servPk cryptoffi.SigPublicKey) bool {
@@ -34,3 +91,30 @@ func (e *Evid) Check(servPk cryptoffi.SigPublicKey) bool {
 	}
 	return std.BytesEqual(e.sigDig0.Dig, e.sigDig1.Dig)
 }
+
+// Check returns an error if the evidence does not check out.
+// otherwise, it proves that the server signed ServDig and vouched that
+// Updates make it. the mismatch itself needs the map through the
+// prior epoch to confirm.
+func (e *UpdEvid) Check(servPk cryptoffi.SigPublicKey) bool {
+	if CheckSigDig(e.ServDig, servPk) {
+		return true
+	}
+	return CheckUpdSig(e.ServDig.Epoch, e.ServDig.Dig, e.Updates, e.UpdSig, servPk)
+}
+
+// Check returns an error if the evidence does not check out.
+// otherwise, it proves that the auditor with adtrPk was dishonest.
+func (e *AdtrEvid) Check(adtrPk cryptoffi.SigPublicKey) bool {
+	adtrDig0 := &SigDig{Epoch: e.epoch, Dig: e.info0.Dig, Sig: e.info0.AdtrSig}
+	err0 := CheckAdtrSigDig(e.logId, adtrDig0, adtrPk)
+	if err0 {
+		return true
+	}
+	adtrDig1 := &SigDig{Epoch: e.epoch, Dig: e.info1.Dig, Sig: e.info1.AdtrSig}
+	err1 := CheckAdtrSigDig(e.logId, adtrDig1, adtrPk)
+	if err1 {
+		return true
+	}
+	return std.BytesEqual(e.info0.Dig, e.info1.Dig)
+}
@@ -0,0 +1,533 @@
+package kt
+
+// the http gateway is unverified. it serves the server and auditor apis
+// as JSON over http, for clients that can't speak advrpc.
+// uint64s are JSON strings, since JS numbers can't hold them,
+// and byte slices are base64, as in encoding/json.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mit-pdos/pav/cryptoffi"
+)
+
+const (
+	// HttpPrefix starts every gateway path. it changes along with
+	// breaking changes to the JSON messages.
+	HttpPrefix string = "/v1/"
+	// HttpCallerHeader has a lookup caller's uid, in decimal.
+	HttpCallerHeader string = "X-Kt-Caller"
+	// HttpCredHeader has a lookup caller's cred, in base64.
+	HttpCredHeader string = "X-Kt-Cred"
+	// maxHttpBody bounds request and reply bodies, in bytes.
+	maxHttpBody int64 = 1 << 28
+)
+
+// # JSON messages
+
+type jsonSigDig struct {
+	Epoch  uint64       `json:"epoch,string"`
+	Dig    []byte       `json:"dig"`
+	Sig    []byte       `json:"sig"`
+	Cosigs []*jsonCosig `json:"cosigs"`
+}
+
+type jsonCosig struct {
+	AdtrPk []byte `json:"adtrPk"`
+	Sig    []byte `json:"sig"`
+}
+
+type jsonCommitOpen struct {
+	Val  []byte `json:"val"`
+	Rand []byte `json:"rand"`
+}
+
+type jsonMemb struct {
+	LabelProof  []byte          `json:"labelProof"`
+	EpochAdded  uint64          `json:"epochAdded,string"`
+	PkOpen      *jsonCommitOpen `json:"pkOpen"`
+	MerkleProof []byte          `json:"merkleProof"`
+}
+
+type jsonMembHide struct {
+	LabelProof  []byte `json:"labelProof"`
+	MapVal      []byte `json:"mapVal"`
+	MerkleProof []byte `json:"merkleProof"`
+}
+
+type jsonNonMemb struct {
+	LabelProof  []byte `json:"labelProof"`
+	MerkleProof []byte `json:"merkleProof"`
+}
+
+type jsonLatestProof struct {
+	LabelProof  []byte          `json:"labelProof"`
+	PkOpen      *jsonCommitOpen `json:"pkOpen"`
+	MerkleProof []byte          `json:"merkleProof"`
+}
+
+// jsonUpdate is a single map update. map labels are raw bytes,
+// which aren't valid JSON object keys.
+type jsonUpdate struct {
+	Label []byte `json:"label"`
+	Val   []byte `json:"val"`
+}
+
+type jsonUpdateProof struct {
+	Updates []*jsonUpdate `json:"updates"`
+	Dig     []byte        `json:"dig"`
+	Sig     []byte        `json:"sig"`
+	UpdSig  []byte        `json:"updSig"`
+}
+
+type jsonAdtrEpochInfo struct {
+	Dig     []byte `json:"dig"`
+	ServSig []byte `json:"servSig"`
+	AdtrSig []byte `json:"adtrSig"`
+}
+
+type jsonPutArg struct {
+	Uid uint64 `json:"uid,string"`
+	Pk  []byte `json:"pk"`
+}
+
+type jsonPutReply struct {
+	Dig    *jsonSigDig  `json:"dig"`
+	Latest *jsonMemb    `json:"latest"`
+	Bound  *jsonNonMemb `json:"bound"`
+	Err    bool         `json:"err"`
+}
+
+type jsonGetReply struct {
+	Dig    *jsonSigDig     `json:"dig"`
+	Hist   []*jsonMembHide `json:"hist"`
+	IsReg  bool            `json:"isReg"`
+	Latest *jsonMemb       `json:"latest"`
+	Bound  *jsonNonMemb    `json:"bound"`
+}
+
+type jsonGetLatestReply struct {
+	Dig    *jsonSigDig      `json:"dig"`
+	IsReg  bool             `json:"isReg"`
+	Latest *jsonLatestProof `json:"latest"`
+}
+
+type jsonSelfMonReply struct {
+	Dig    *jsonSigDig      `json:"dig"`
+	Bound  *jsonNonMemb     `json:"bound"`
+	Latest *jsonLatestProof `json:"latest"`
+}
+
+type jsonAuditReply struct {
+	P   *jsonUpdateProof `json:"p"`
+	Err bool             `json:"err"`
+}
+
+type jsonAdtrGetReply struct {
+	X   *jsonAdtrEpochInfo `json:"x"`
+	Err bool               `json:"err"`
+}
+
+// # Converters
+//
+// the from funcs check for missing fields, which the adversary controls.
+
+func toJsonSigDig(o *SigDig) *jsonSigDig {
+	cosigs := make([]*jsonCosig, 0, len(o.Cosigs))
+	for _, cosig := range o.Cosigs {
+		cosigs = append(cosigs, &jsonCosig{AdtrPk: cosig.AdtrPk, Sig: cosig.Sig})
+	}
+	return &jsonSigDig{Epoch: o.Epoch, Dig: o.Dig, Sig: o.Sig, Cosigs: cosigs}
+}
+
+func fromJsonSigDig(o *jsonSigDig) (*SigDig, bool) {
+	if o == nil {
+		return nil, true
+	}
+	cosigs := make([]*Cosig, 0, len(o.Cosigs))
+	for _, cosig := range o.Cosigs {
+		if cosig == nil {
+			return nil, true
+		}
+		cosigs = append(cosigs, &Cosig{AdtrPk: cosig.AdtrPk, Sig: cosig.Sig})
+	}
+	return &SigDig{Epoch: o.Epoch, Dig: o.Dig, Sig: o.Sig, Cosigs: cosigs}, false
+}
+
+func toJsonMemb(o *Memb) *jsonMemb {
+	open := &jsonCommitOpen{Val: o.PkOpen.Val, Rand: o.PkOpen.Rand}
+	return &jsonMemb{LabelProof: o.LabelProof, EpochAdded: o.EpochAdded, PkOpen: open, MerkleProof: o.MerkleProof}
+}
+
+func fromJsonMemb(o *jsonMemb) (*Memb, bool) {
+	if o == nil || o.PkOpen == nil {
+		return nil, true
+	}
+	open := &CommitOpen{Val: o.PkOpen.Val, Rand: o.PkOpen.Rand}
+	return &Memb{LabelProof: o.LabelProof, EpochAdded: o.EpochAdded, PkOpen: open, MerkleProof: o.MerkleProof}, false
+}
+
+func toJsonHist(hist []*MembHide) []*jsonMembHide {
+	out := make([]*jsonMembHide, 0, len(hist))
+	for _, o := range hist {
+		out = append(out, &jsonMembHide{LabelProof: o.LabelProof, MapVal: o.MapVal, MerkleProof: o.MerkleProof})
+	}
+	return out
+}
+
+func fromJsonHist(hist []*jsonMembHide) ([]*MembHide, bool) {
+	out := make([]*MembHide, 0, len(hist))
+	for _, o := range hist {
+		if o == nil {
+			return nil, true
+		}
+		out = append(out, &MembHide{LabelProof: o.LabelProof, MapVal: o.MapVal, MerkleProof: o.MerkleProof})
+	}
+	return out, false
+}
+
+func toJsonNonMemb(o *NonMemb) *jsonNonMemb {
+	return &jsonNonMemb{LabelProof: o.LabelProof, MerkleProof: o.MerkleProof}
+}
+
+func fromJsonNonMemb(o *jsonNonMemb) (*NonMemb, bool) {
+	if o == nil {
+		return nil, true
+	}
+	return &NonMemb{LabelProof: o.LabelProof, MerkleProof: o.MerkleProof}, false
+}
+
+func toJsonLatestProof(o *LatestProof) *jsonLatestProof {
+	open := &jsonCommitOpen{Val: o.PkOpen.Val, Rand: o.PkOpen.Rand}
+	return &jsonLatestProof{LabelProof: o.LabelProof, PkOpen: open, MerkleProof: o.MerkleProof}
+}
+
+func fromJsonLatestProof(o *jsonLatestProof) (*LatestProof, bool) {
+	if o == nil || o.PkOpen == nil {
+		return nil, true
+	}
+	open := &CommitOpen{Val: o.PkOpen.Val, Rand: o.PkOpen.Rand}
+	return &LatestProof{LabelProof: o.LabelProof, PkOpen: open, MerkleProof: o.MerkleProof}, false
+}
+
+func toJsonUpdateProof(o *UpdateProof) *jsonUpdateProof {
+	upds := make([]*jsonUpdate, 0, len(o.Updates))
+	for label, val := range o.Updates {
+		upds = append(upds, &jsonUpdate{Label: []byte(label), Val: val})
+	}
+	return &jsonUpdateProof{Updates: upds, Dig: o.Dig, Sig: o.Sig, UpdSig: o.UpdSig}
+}
+
+func toJsonAdtrEpochInfo(o *AdtrEpochInfo) *jsonAdtrEpochInfo {
+	return &jsonAdtrEpochInfo{Dig: o.Dig, ServSig: o.ServSig, AdtrSig: o.AdtrSig}
+}
+
+func fromJsonAdtrEpochInfo(o *jsonAdtrEpochInfo) (*AdtrEpochInfo, bool) {
+	if o == nil {
+		return nil, true
+	}
+	return &AdtrEpochInfo{Dig: o.Dig, ServSig: o.ServSig, AdtrSig: o.AdtrSig}, false
+}
+
+// # Server
+
+// NewHttpServer returns a gateway to s, with routes:
+//
+//	POST HttpPrefix+"put", with a JSON {uid, pk} body.
+//	GET HttpPrefix+"get?uid=".
+//	GET HttpPrefix+"getlatest?uid=".
+//	GET HttpPrefix+"selfmon?uid=".
+//	GET HttpPrefix+"audit?epoch=".
+func NewHttpServer(s *Server) http.Handler {
+	return NewHttpServerAuth(s, nil)
+}
+
+// NewHttpServerAuth is like NewHttpServer, but authz, if non-nil,
+// decides which lookups to answer, with a 403 for the others.
+// get, which has the history, is then only for uid's owner.
+// serve it over https, since the creds are bearer tokens.
+// callers identify themselves with the HttpCallerHeader and
+// HttpCredHeader headers.
+func NewHttpServerAuth(s *Server, authz Authorizer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+HttpPrefix+"put", func(w http.ResponseWriter, r *http.Request) {
+		arg := &jsonPutArg{}
+		if readJsonBody(w, r, arg) {
+			return
+		}
+		dig, latest, bound, err := s.Put(arg.Uid, arg.Pk)
+		reply := &jsonPutReply{Err: err}
+		if !err {
+			reply.Dig = toJsonSigDig(dig)
+			reply.Latest = toJsonMemb(latest)
+			reply.Bound = toJsonNonMemb(bound)
+		}
+		writeJson(w, reply)
+	})
+	mux.HandleFunc("GET "+HttpPrefix+"get", func(w http.ResponseWriter, r *http.Request) {
+		uid, err0 := readUintQuery(w, r, "uid")
+		if err0 {
+			return
+		}
+		if checkHttpAuth(w, r, authz, uid, true) {
+			return
+		}
+		dig, hist, isReg, latest, bound := s.Get(uid)
+		writeJson(w, &jsonGetReply{Dig: toJsonSigDig(dig), Hist: toJsonHist(hist), IsReg: isReg, Latest: toJsonMemb(latest), Bound: toJsonNonMemb(bound)})
+	})
+	mux.HandleFunc("GET "+HttpPrefix+"getlatest", func(w http.ResponseWriter, r *http.Request) {
+		uid, err0 := readUintQuery(w, r, "uid")
+		if err0 {
+			return
+		}
+		if checkHttpAuth(w, r, authz, uid, false) {
+			return
+		}
+		dig, isReg, latest := s.GetLatest(uid)
+		writeJson(w, &jsonGetLatestReply{Dig: toJsonSigDig(dig), IsReg: isReg, Latest: toJsonLatestProof(latest)})
+	})
+	mux.HandleFunc("GET "+HttpPrefix+"selfmon", func(w http.ResponseWriter, r *http.Request) {
+		uid, err0 := readUintQuery(w, r, "uid")
+		if err0 {
+			return
+		}
+		if checkHttpAuth(w, r, authz, uid, false) {
+			return
+		}
+		dig, bound, latest := s.SelfMon(uid)
+		writeJson(w, &jsonSelfMonReply{Dig: toJsonSigDig(dig), Bound: toJsonNonMemb(bound), Latest: toJsonLatestProof(latest)})
+	})
+	mux.HandleFunc("GET "+HttpPrefix+"audit", func(w http.ResponseWriter, r *http.Request) {
+		epoch, err0 := readUintQuery(w, r, "epoch")
+		if err0 {
+			return
+		}
+		p, err1 := s.Audit(epoch)
+		writeJson(w, &jsonAuditReply{P: toJsonUpdateProof(p), Err: err1})
+	})
+	return mux
+}
+
+// NewHttpAuditor returns a gateway to a, with route
+// GET HttpPrefix+"get?log=&epoch=", where log is the
+// url-safe base64 log id.
+func NewHttpAuditor(a *Auditor) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+HttpPrefix+"get", func(w http.ResponseWriter, r *http.Request) {
+		logId, err0 := base64.URLEncoding.DecodeString(r.URL.Query().Get("log"))
+		if err0 != nil {
+			http.Error(w, "bad log param", http.StatusBadRequest)
+			return
+		}
+		epoch, err1 := readUintQuery(w, r, "epoch")
+		if err1 {
+			return
+		}
+		x, err2 := a.Get(logId, epoch)
+		writeJson(w, &jsonAdtrGetReply{X: toJsonAdtrEpochInfo(x), Err: err2})
+	})
+	return mux
+}
+
+// readJsonBody decodes the request body into v.
+// on fail, it replies with an http error and errors.
+func readJsonBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	body := http.MaxBytesReader(w, r.Body, maxHttpBody)
+	if json.NewDecoder(body).Decode(v) != nil {
+		http.Error(w, "bad json body", http.StatusBadRequest)
+		return true
+	}
+	return false
+}
+
+// readUintQuery reads a uint64 query param.
+// on fail, it replies with an http error and errors.
+func readUintQuery(w http.ResponseWriter, r *http.Request, key string) (uint64, bool) {
+	x, err := strconv.ParseUint(r.URL.Query().Get(key), 10, 64)
+	if err != nil {
+		http.Error(w, "bad "+key+" param", http.StatusBadRequest)
+		return 0, true
+	}
+	return x, false
+}
+
+// checkHttpAuth errors, and writes a 403, if authz denies r's lookup of uid.
+// hist lookups are only for uid's owner.
+func checkHttpAuth(w http.ResponseWriter, r *http.Request, authz Authorizer, uid uint64, hist bool) bool {
+	if authz == nil {
+		return false
+	}
+	caller := readHttpCaller(r)
+	var err0 bool
+	if hist {
+		err0 = authHist(authz, caller, uid)
+	} else {
+		err0 = authz.AuthGet(caller, uid)
+	}
+	if err0 {
+		http.Error(w, "lookup denied", http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// readHttpCaller returns the caller in r's headers, or nil if they're bad.
+func readHttpCaller(r *http.Request) *Caller {
+	uid, err0 := strconv.ParseUint(r.Header.Get(HttpCallerHeader), 10, 64)
+	if err0 != nil {
+		return nil
+	}
+	cred, err1 := base64.StdEncoding.DecodeString(r.Header.Get(HttpCredHeader))
+	if err1 != nil {
+		return nil
+	}
+	return &Caller{Uid: uid, Cred: cred}
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	// ignore errors. if err, the client sees a bad reply.
+	json.NewEncoder(w).Encode(v)
+}
+
+// # Client
+
+type httpServConn struct {
+	url string
+	hc  *http.Client
+}
+
+// NewHttpClient is like NewClient, but it talks to a gateway at url,
+// e.g., "https://kt.example.com". it verifies replies the same way.
+// unlike advrpc Gets, gateway calls don't retry on fail.
+func NewHttpClient(uid uint64, url string, hc *http.Client, servSigPk cryptoffi.SigPublicKey, servParams *SigParams) (*Client, bool) {
+	// http.Client already pools conns.
+	conn := &httpServConn{url: url, hc: hc}
+	servTLS := strings.HasPrefix(url, "https://")
+	return newClient(uid, func() (servConn, bool) {
+		return conn, false
+	}, servTLS, servSigPk, servParams)
+}
+
+// AuditHttp is like Audit, but with an auditor gateway at url.
+func (c *Client) AuditHttp(url string, hc *http.Client, adtrPk cryptoffi.SigPublicKey) *ClientErr {
+	log := base64.URLEncoding.EncodeToString(c.servSigPk)
+	return c.audit(func(epochs []uint64) ([]*AdtrEpochInfo, bool) {
+		infos := make([]*AdtrEpochInfo, 0, len(epochs))
+		for _, epoch := range epochs {
+			reply := &jsonAdtrGetReply{}
+			if httpGet(hc, url+HttpPrefix+"get?log="+log+"&epoch="+strconv.FormatUint(epoch, 10), nil, reply) {
+				return nil, true
+			}
+			if reply.Err {
+				return nil, true
+			}
+			info, err := fromJsonAdtrEpochInfo(reply.X)
+			if err {
+				return nil, true
+			}
+			infos = append(infos, info)
+		}
+		return infos, false
+	}, adtrPk)
+}
+
+// close does nothing, since hc belongs to the caller.
+func (c *httpServConn) close() {
+}
+
+func (c *httpServConn) put(uid uint64, pk []byte) (*SigDig, *Memb, *NonMemb, bool) {
+	arg, err0 := json.Marshal(&jsonPutArg{Uid: uid, Pk: pk})
+	if err0 != nil {
+		return nil, nil, nil, true
+	}
+	resp, err1 := c.hc.Post(c.url+HttpPrefix+"put", "application/json", bytes.NewReader(arg))
+	if err1 != nil {
+		return nil, nil, nil, true
+	}
+	reply := &jsonPutReply{}
+	if readJsonResp(resp, reply) || reply.Err {
+		return nil, nil, nil, true
+	}
+	dig, err2 := fromJsonSigDig(reply.Dig)
+	latest, err3 := fromJsonMemb(reply.Latest)
+	bound, err4 := fromJsonNonMemb(reply.Bound)
+	if err2 || err3 || err4 {
+		return nil, nil, nil, true
+	}
+	return dig, latest, bound, false
+}
+
+func (c *httpServConn) get(caller *Caller, uid uint64) (*SigDig, []*MembHide, bool, *Memb, *NonMemb, bool) {
+	reply := &jsonGetReply{}
+	if httpGet(c.hc, c.url+HttpPrefix+"get?uid="+strconv.FormatUint(uid, 10), caller, reply) {
+		return nil, nil, false, nil, nil, true
+	}
+	dig, err0 := fromJsonSigDig(reply.Dig)
+	hist, err1 := fromJsonHist(reply.Hist)
+	latest, err2 := fromJsonMemb(reply.Latest)
+	bound, err3 := fromJsonNonMemb(reply.Bound)
+	if err0 || err1 || err2 || err3 {
+		return nil, nil, false, nil, nil, true
+	}
+	return dig, hist, reply.IsReg, latest, bound, false
+}
+
+func (c *httpServConn) getLatest(caller *Caller, uid uint64) (*SigDig, bool, *LatestProof, bool) {
+	reply := &jsonGetLatestReply{}
+	if httpGet(c.hc, c.url+HttpPrefix+"getlatest?uid="+strconv.FormatUint(uid, 10), caller, reply) {
+		return nil, false, nil, true
+	}
+	dig, err0 := fromJsonSigDig(reply.Dig)
+	latest, err1 := fromJsonLatestProof(reply.Latest)
+	if err0 || err1 {
+		return nil, false, nil, true
+	}
+	return dig, reply.IsReg, latest, false
+}
+
+func (c *httpServConn) selfMon(caller *Caller, uid uint64) (*SigDig, *NonMemb, *LatestProof, bool) {
+	reply := &jsonSelfMonReply{}
+	if httpGet(c.hc, c.url+HttpPrefix+"selfmon?uid="+strconv.FormatUint(uid, 10), caller, reply) {
+		return nil, nil, nil, true
+	}
+	dig, err0 := fromJsonSigDig(reply.Dig)
+	bound, err1 := fromJsonNonMemb(reply.Bound)
+	latest, err2 := fromJsonLatestProof(reply.Latest)
+	if err0 || err1 || err2 {
+		return nil, nil, nil, true
+	}
+	return dig, bound, latest, false
+}
+
+// httpGet decodes the JSON reply from url into v, and errors on fail.
+// it identifies caller, if non-nil, in the request headers.
+func httpGet(hc *http.Client, url string, caller *Caller, v any) bool {
+	req, err0 := http.NewRequest("GET", url, nil)
+	if err0 != nil {
+		return true
+	}
+	if caller != nil {
+		req.Header.Set(HttpCallerHeader, strconv.FormatUint(caller.Uid, 10))
+		req.Header.Set(HttpCredHeader, base64.StdEncoding.EncodeToString(caller.Cred))
+	}
+	resp, err1 := hc.Do(req)
+	if err1 != nil {
+		return true
+	}
+	return readJsonResp(resp, v)
+}
+
+// readJsonResp decodes resp into v, closes resp, and errors on fail.
+func readJsonResp(resp *http.Response, v any) bool {
+	body := io.LimitReader(resp.Body, maxHttpBody)
+	err := resp.StatusCode != http.StatusOK || json.NewDecoder(body).Decode(v) != nil
+	resp.Body.Close()
+	return err
+}
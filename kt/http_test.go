@@ -0,0 +1,78 @@
+package kt
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttp(t *testing.T) {
+	serv, sigPk, _ := NewServer()
+	servWeb := httptest.NewServer(NewHttpServer(serv))
+	defer servWeb.Close()
+	aud, audPk := NewAuditor(sigPk)
+	audWeb := httptest.NewServer(NewHttpAuditor(aud))
+	defer audWeb.Close()
+
+	alice, err0 := NewHttpClient(0, servWeb.URL, servWeb.Client(), sigPk, serv.Params())
+	if err0 {
+		t.Fatal()
+	}
+	bob, err1 := NewHttpClient(1, servWeb.URL, servWeb.Client(), sigPk, serv.Params())
+	if err1 {
+		t.Fatal()
+	}
+
+	pk := []byte{1, 2}
+	ep, err2 := alice.Put(pk)
+	if err2.Err {
+		t.Fatal()
+	}
+	if _, err := alice.SelfMon(); err.Err {
+		t.Fatal()
+	}
+	isReg, pk0, _, err3 := bob.Get(0)
+	if err3.Err || !isReg || !bytes.Equal(pk, pk0) {
+		t.Fatal()
+	}
+	isReg1, pk1, _, err4 := bob.GetLatest(0)
+	if err4.Err || !isReg1 || !bytes.Equal(pk, pk1) {
+		t.Fatal()
+	}
+
+	// sync auditor through the latest epoch.
+	for e := uint64(0); e <= ep; e++ {
+		p, err := serv.Audit(e)
+		if err {
+			t.Fatal()
+		}
+		if _, err = aud.Update(sigPk, p); err {
+			t.Fatal()
+		}
+	}
+	if alice.AuditHttp(audWeb.URL, audWeb.Client(), audPk).Err {
+		t.Fatal()
+	}
+	if bob.AuditHttp(audWeb.URL, audWeb.Client(), audPk).Err {
+		t.Fatal()
+	}
+}
+
+func TestHttpBadReq(t *testing.T) {
+	serv, _, _ := NewServer()
+	servWeb := httptest.NewServer(NewHttpServer(serv))
+	defer servWeb.Close()
+	hc := servWeb.Client()
+
+	resp0, err0 := hc.Get(servWeb.URL + HttpPrefix + "get?uid=x")
+	if err0 != nil || resp0.StatusCode != http.StatusBadRequest {
+		t.Fatal()
+	}
+	resp0.Body.Close()
+	resp1, err1 := hc.Post(servWeb.URL+HttpPrefix+"put", "application/json", bytes.NewReader([]byte("{")))
+	if err1 != nil || resp1.StatusCode != http.StatusBadRequest {
+		t.Fatal()
+	}
+	resp1.Body.Close()
+}
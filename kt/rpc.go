@@ -1,7 +1,26 @@
 package kt
 
 import (
+	"context"
+	"time"
+
+	"github.com/goose-lang/std"
 	"github.com/mit-pdos/pav/advrpc"
+	"github.com/mit-pdos/pav/marshalutil"
+	"github.com/tchajed/marshal"
+)
+
+const (
+	// ProtoVersion is the version of the kt rpc messages.
+	ProtoVersion uint64 = 7
+)
+
+// bounds on the retries of idempotent calls.
+const (
+	maxCallTries uint64 = 5
+	// callBackoff is the first sleep between tries, in nanoseconds.
+	// it doubles after each try.
+	callBackoff uint64 = 10_000_000
 )
 
 const (
@@ -9,83 +28,186 @@ const (
 	ServerGetRpc     uint64 = 1
 	ServerSelfMonRpc uint64 = 2
 	ServerAuditRpc   uint64 = 3
-	AdtrUpdateRpc    uint64 = 0
-	AdtrGetRpc       uint64 = 1
+	// ServerAuditWaitRpc long-polls for an epoch, with the same
+	// messages as ServerAuditRpc.
+	ServerAuditWaitRpc  uint64 = 4
+	ServerAuditRangeRpc uint64 = 5
+	ServerGetLatestRpc  uint64 = 6
+	AdtrUpdateRpc       uint64 = 0
+	AdtrGetRpc          uint64 = 1
+	AdtrGetManyRpc      uint64 = 2
 )
 
+// NewRpcServer serves s with no Authorizer, so all lookups,
+// including Get's history, are open to all.
 func NewRpcServer(s *Server) *advrpc.Server {
+	return NewRpcServerAuth(s, nil)
+}
+
+// NewRpcServerAuth is like NewRpcServer, but authz, if non-nil,
+// decides which lookups to answer. Get, which has the history,
+// is then only for uid's owner.
+// serve it with TLS, since the creds are bearer tokens.
+func NewRpcServerAuth(s *Server, authz Authorizer) *advrpc.Server {
 	h := make(map[uint64]func([]byte, *[]byte))
 	h[ServerPutRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
 		argObj, _, err0 := ServerPutArgDecode(arg)
 		if err0 {
 			return
 		}
 		ret0, ret1, ret2, ret3 := s.Put(argObj.Uid, argObj.Pk)
-		replyObj := &ServerPutReply{Dig: ret0, Latest: ret1, Bound: ret2, Err: ret3}
+		replyObj := &ServerPutReply{Version: ProtoVersion, Dig: ret0, Latest: ret1, Bound: ret2, Err: ret3}
 		*reply = ServerPutReplyEncode(*reply, replyObj)
 	}
 	h[ServerGetRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
 		argObj, _, err0 := ServerGetArgDecode(arg)
 		if err0 {
 			return
 		}
+		if authz != nil && authHist(authz, argObj.Caller, argObj.Uid) {
+			replyObj := &ServerGetReply{Version: ProtoVersion, Dig: &SigDig{}, Latest: &Memb{PkOpen: &CommitOpen{}}, Bound: &NonMemb{}, Err: true}
+			*reply = ServerGetReplyEncode(*reply, replyObj)
+			return
+		}
 		ret0, ret1, ret2, ret3, ret4 := s.Get(argObj.Uid)
-		replyObj := &ServerGetReply{Dig: ret0, Hist: ret1, IsReg: ret2, Latest: ret3, Bound: ret4}
+		replyObj := &ServerGetReply{Version: ProtoVersion, Dig: ret0, Hist: ret1, IsReg: ret2, Latest: ret3, Bound: ret4}
 		*reply = ServerGetReplyEncode(*reply, replyObj)
 	}
+	h[ServerGetLatestRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
+		argObj, _, err0 := ServerGetLatestArgDecode(arg)
+		if err0 {
+			return
+		}
+		if authz != nil && authz.AuthGet(argObj.Caller, argObj.Uid) {
+			replyObj := &ServerGetLatestReply{Version: ProtoVersion, Dig: &SigDig{}, Latest: &LatestProof{PkOpen: &CommitOpen{}}, Err: true}
+			*reply = ServerGetLatestReplyEncode(*reply, replyObj)
+			return
+		}
+		ret0, ret1, ret2 := s.GetLatest(argObj.Uid)
+		replyObj := &ServerGetLatestReply{Version: ProtoVersion, Dig: ret0, IsReg: ret1, Latest: ret2}
+		*reply = ServerGetLatestReplyEncode(*reply, replyObj)
+	}
 	h[ServerSelfMonRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
 		argObj, _, err0 := ServerSelfMonArgDecode(arg)
 		if err0 {
 			return
 		}
-		ret0, ret1 := s.SelfMon(argObj.Uid)
-		replyObj := &ServerSelfMonReply{Dig: ret0, Bound: ret1}
+		if authz != nil && authz.AuthGet(argObj.Caller, argObj.Uid) {
+			replyObj := &ServerSelfMonReply{Version: ProtoVersion, Dig: &SigDig{}, Bound: &NonMemb{}, Latest: &LatestProof{PkOpen: &CommitOpen{}}, Err: true}
+			*reply = ServerSelfMonReplyEncode(*reply, replyObj)
+			return
+		}
+		ret0, ret1, ret2 := s.SelfMon(argObj.Uid)
+		replyObj := &ServerSelfMonReply{Version: ProtoVersion, Dig: ret0, Bound: ret1, Latest: ret2}
 		*reply = ServerSelfMonReplyEncode(*reply, replyObj)
 	}
 	h[ServerAuditRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
 		argObj, _, err0 := ServerAuditArgDecode(arg)
 		if err0 {
 			return
 		}
 		ret0, ret1 := s.Audit(argObj.Epoch)
-		replyObj := &ServerAuditReply{P: ret0, Err: ret1}
+		replyObj := &ServerAuditReply{Version: ProtoVersion, P: ret0, Err: ret1}
 		*reply = ServerAuditReplyEncode(*reply, replyObj)
 	}
+	h[ServerAuditWaitRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
+		argObj, _, err0 := ServerAuditArgDecode(arg)
+		if err0 {
+			return
+		}
+		ret0, ret1 := s.AuditWait(argObj.Epoch)
+		replyObj := &ServerAuditReply{Version: ProtoVersion, P: ret0, Err: ret1}
+		*reply = ServerAuditReplyEncode(*reply, replyObj)
+	}
+	h[ServerAuditRangeRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
+		argObj, _, err0 := ServerAuditRangeArgDecode(arg)
+		if err0 {
+			return
+		}
+		ret0, ret1, ret2 := s.AuditRange(argObj.Start, argObj.Limit)
+		replyObj := &ServerAuditRangeReply{Version: ProtoVersion, Ps: ret0, Next: ret1, Err: ret2}
+		*reply = ServerAuditRangeReplyEncode(*reply, replyObj)
+	}
 	return advrpc.NewServer(h)
 }
 
 func NewRpcAuditor(a *Auditor) *advrpc.Server {
 	h := make(map[uint64]func([]byte, *[]byte))
 	h[AdtrUpdateRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
 		argObj, _, err0 := AdtrUpdateArgDecode(arg)
 		if err0 {
 			return
 		}
-		ret0 := a.Update(argObj.P)
-		replyObj := &AdtrUpdateReply{Err: ret0}
+		ret0, ret1 := a.Update(argObj.LogId, argObj.P)
+		if ret0 == nil {
+			ret0 = &UpdEvid{ServDig: &SigDig{}}
+		}
+		replyObj := &AdtrUpdateReply{Version: ProtoVersion, Evid: ret0, Err: ret1}
 		*reply = AdtrUpdateReplyEncode(*reply, replyObj)
 	}
 	h[AdtrGetRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
 		argObj, _, err0 := AdtrGetArgDecode(arg)
 		if err0 {
 			return
 		}
-		ret0, ret1 := a.Get(argObj.Epoch)
-		replyObj := &AdtrGetReply{X: ret0, Err: ret1}
+		ret0, ret1 := a.Get(argObj.LogId, argObj.Epoch)
+		replyObj := &AdtrGetReply{Version: ProtoVersion, X: ret0, Err: ret1}
 		*reply = AdtrGetReplyEncode(*reply, replyObj)
 	}
+	h[AdtrGetManyRpc] = func(arg []byte, reply *[]byte) {
+		if checkArgVersion(arg, reply) {
+			return
+		}
+		argObj, _, err0 := AdtrGetManyArgDecode(arg)
+		if err0 {
+			return
+		}
+		ret0, ret1 := a.GetMany(argObj.LogId, argObj.Epochs)
+		replyObj := &AdtrGetManyReply{Version: ProtoVersion, Xs: ret0, Err: ret1}
+		*reply = AdtrGetManyReplyEncode(*reply, replyObj)
+	}
 	return advrpc.NewServer(h)
 }
 
-func CallServPut(c *advrpc.Client, uid uint64, pk []byte) (*SigDig, *Memb, *NonMemb, bool) {
-	arg := &ServerPutArg{Uid: uid, Pk: pk}
+func CallServPut(ctx context.Context, c *advrpc.Client, uid uint64, pk []byte) (*SigDig, *Memb, *NonMemb, bool) {
+	arg := &ServerPutArg{Version: ProtoVersion, Uid: uid, Pk: pk}
 	argByt := ServerPutArgEncode(make([]byte, 0), arg)
 	replyByt := new([]byte)
-	var err0 = true
-	for err0 {
-		// this "removes" possibility of net failure.
-		// should prob have some retry backoff mechanism.
-		err0 = c.Call(ServerPutRpc, argByt, replyByt)
+	// no retry. a timed-out put might have gone through,
+	// and a second put would register another version.
+	err0 := c.CallCtx(ctx, ServerPutRpc, argByt, replyByt)
+	if err0 {
+		return nil, nil, nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, nil, nil, true
 	}
 	reply, _, err1 := ServerPutReplyDecode(*replyByt)
 	if err1 {
@@ -94,43 +216,87 @@ func CallServPut(c *advrpc.Client, uid uint64, pk []byte) (*SigDig, *Memb, *NonM
 	return reply.Dig, reply.Latest, reply.Bound, reply.Err
 }
 
-func CallServGet(c *advrpc.Client, uid uint64) (*SigDig, []*MembHide, bool, *Memb, *NonMemb, bool) {
-	arg := &ServerGetArg{Uid: uid}
+// CallServGet errors if the call fails, e.g., if the server's
+// Authorizer denies caller. the same goes for the other lookups.
+func CallServGet(ctx context.Context, c *advrpc.Client, caller *Caller, uid uint64) (*SigDig, []*MembHide, bool, *Memb, *NonMemb, bool) {
+	arg := &ServerGetArg{Version: ProtoVersion, Uid: uid, Caller: caller}
 	argByt := ServerGetArgEncode(make([]byte, 0), arg)
 	replyByt := new([]byte)
-	var err0 = true
-	for err0 {
-		err0 = c.Call(ServerGetRpc, argByt, replyByt)
+	if callRetry(ctx, c, ServerGetRpc, argByt, replyByt) {
+		return nil, nil, false, nil, nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, nil, false, nil, nil, true
 	}
 	reply, _, err1 := ServerGetReplyDecode(*replyByt)
 	if err1 {
 		return nil, nil, false, nil, nil, true
 	}
-	return reply.Dig, reply.Hist, reply.IsReg, reply.Latest, reply.Bound, false
+	return reply.Dig, reply.Hist, reply.IsReg, reply.Latest, reply.Bound, reply.Err
+}
+
+func CallServGetLatest(ctx context.Context, c *advrpc.Client, caller *Caller, uid uint64) (*SigDig, bool, *LatestProof, bool) {
+	arg := &ServerGetLatestArg{Version: ProtoVersion, Uid: uid, Caller: caller}
+	argByt := ServerGetLatestArgEncode(make([]byte, 0), arg)
+	replyByt := new([]byte)
+	if callRetry(ctx, c, ServerGetLatestRpc, argByt, replyByt) {
+		return nil, false, nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, false, nil, true
+	}
+	reply, _, err1 := ServerGetLatestReplyDecode(*replyByt)
+	if err1 {
+		return nil, false, nil, true
+	}
+	return reply.Dig, reply.IsReg, reply.Latest, reply.Err
 }
 
-func CallServSelfMon(c *advrpc.Client, uid uint64) (*SigDig, *NonMemb, bool) {
-	arg := &ServerSelfMonArg{Uid: uid}
+func CallServSelfMon(ctx context.Context, c *advrpc.Client, caller *Caller, uid uint64) (*SigDig, *NonMemb, *LatestProof, bool) {
+	arg := &ServerSelfMonArg{Version: ProtoVersion, Uid: uid, Caller: caller}
 	argByt := ServerSelfMonArgEncode(make([]byte, 0), arg)
 	replyByt := new([]byte)
-	var err0 = true
-	for err0 {
-		err0 = c.Call(ServerSelfMonRpc, argByt, replyByt)
+	if callRetry(ctx, c, ServerSelfMonRpc, argByt, replyByt) {
+		return nil, nil, nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, nil, nil, true
 	}
 	reply, _, err1 := ServerSelfMonReplyDecode(*replyByt)
 	if err1 {
-		return nil, nil, true
+		return nil, nil, nil, true
+	}
+	return reply.Dig, reply.Bound, reply.Latest, reply.Err
+}
+
+func CallServAudit(ctx context.Context, c *advrpc.Client, epoch uint64) (*UpdateProof, bool) {
+	arg := &ServerAuditArg{Version: ProtoVersion, Epoch: epoch}
+	argByt := ServerAuditArgEncode(make([]byte, 0), arg)
+	replyByt := new([]byte)
+	if callRetry(ctx, c, ServerAuditRpc, argByt, replyByt) {
+		return nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, true
+	}
+	reply, _, err1 := ServerAuditReplyDecode(*replyByt)
+	if err1 {
+		return nil, true
 	}
-	return reply.Dig, reply.Bound, false
+	return reply.P, reply.Err
 }
 
-func CallServAudit(c *advrpc.Client, epoch uint64) (*UpdateProof, bool) {
-	arg := &ServerAuditArg{Epoch: epoch}
+// CallServAuditWait long-polls for epoch. it errors if the server
+// hasn't committed epoch before the server's wait timeout.
+func CallServAuditWait(ctx context.Context, c *advrpc.Client, epoch uint64) (*UpdateProof, bool) {
+	arg := &ServerAuditArg{Version: ProtoVersion, Epoch: epoch}
 	argByt := ServerAuditArgEncode(make([]byte, 0), arg)
 	replyByt := new([]byte)
-	var err0 = true
-	for err0 {
-		err0 = c.Call(ServerAuditRpc, argByt, replyByt)
+	if callRetry(ctx, c, ServerAuditWaitRpc, argByt, replyByt) {
+		return nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, true
 	}
 	reply, _, err1 := ServerAuditReplyDecode(*replyByt)
 	if err1 {
@@ -139,45 +305,95 @@ func CallServAudit(c *advrpc.Client, epoch uint64) (*UpdateProof, bool) {
 	return reply.P, reply.Err
 }
 
-func CallAdtrUpdate(c *advrpc.Client, proof *UpdateProof) bool {
-	arg := &AdtrUpdateArg{P: proof}
+// CallServAuditRange returns the proofs for up to limit epochs from start,
+// and the start of the next range.
+func CallServAuditRange(ctx context.Context, c *advrpc.Client, start, limit uint64) ([]*UpdateProof, uint64, bool) {
+	arg := &ServerAuditRangeArg{Version: ProtoVersion, Start: start, Limit: limit}
+	argByt := ServerAuditRangeArgEncode(make([]byte, 0), arg)
+	replyByt := new([]byte)
+	if callRetry(ctx, c, ServerAuditRangeRpc, argByt, replyByt) {
+		return nil, 0, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, 0, true
+	}
+	reply, _, err1 := ServerAuditRangeReplyDecode(*replyByt)
+	if err1 {
+		return nil, 0, true
+	}
+	// the server can't skip epochs.
+	if reply.Next != start+uint64(len(reply.Ps)) {
+		return nil, 0, true
+	}
+	return reply.Ps, reply.Next, reply.Err
+}
+
+// CallAdtrUpdate errors / evid on fail. the auditor's evid is only
+// returned if it checks out against logId, the server's sig pk.
+// updates aren't idempotent, so it doesn't retry. instead, on fail,
+// it checks if the auditor already has proof as epoch.
+func CallAdtrUpdate(ctx context.Context, c *advrpc.Client, logId []byte, epoch uint64, proof *UpdateProof) (*UpdEvid, bool) {
+	evid, err0 := callAdtrUpdateOnce(ctx, c, logId, proof)
+	if !err0 {
+		return nil, false
+	}
+	if evid != nil {
+		return evid, true
+	}
+	// the update might have gone through before an error.
+	info, err1 := callAdtrGetInner(ctx, c, logId, epoch)
+	if err1 || !std.BytesEqual(info.Dig, proof.Dig) {
+		return nil, true
+	}
+	return nil, false
+}
+
+func callAdtrUpdateOnce(ctx context.Context, c *advrpc.Client, logId []byte, proof *UpdateProof) (*UpdEvid, bool) {
+	arg := &AdtrUpdateArg{Version: ProtoVersion, LogId: logId, P: proof}
 	argByt := AdtrUpdateArgEncode(make([]byte, 0), arg)
 	replyByt := new([]byte)
-	var err0 = true
-	for err0 {
-		err0 = c.Call(AdtrUpdateRpc, argByt, replyByt)
+	if c.CallCtx(ctx, AdtrUpdateRpc, argByt, replyByt) {
+		return nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, true
 	}
 	reply, _, err1 := AdtrUpdateReplyDecode(*replyByt)
 	if err1 {
-		return true
+		return nil, true
+	}
+	if reply.Err && !reply.Evid.Check(logId) {
+		return reply.Evid, true
 	}
-	return reply.Err
+	return nil, reply.Err
 }
 
-func CallAdtrGet(c *advrpc.Client, epoch uint64) *AdtrEpochInfo {
+// CallAdtrGet errors if the auditor hasn't seen epoch after the
+// bounded retries, e.g., if a malicious server sent a very large epoch.
+func CallAdtrGet(ctx context.Context, c *advrpc.Client, logId []byte, epoch uint64) (*AdtrEpochInfo, bool) {
 	var adtrInfo *AdtrEpochInfo
-	var err = true
-	// this "removes" errors from the auditor, which arise from
+	// this retries errors from the auditor, which arise from
 	// not yet having seen an epoch.
-	// this allows us to prove that client.Audit never errors
-	// in a correctness setting.
-	// a malicious server could send a very large epoch to the client,
-	// causing it to infinitely loop.
-	for err {
-		adtrInfo0, err0 := callAdtrGetInner(c, epoch)
+	err := retry(ctx, func() bool {
+		adtrInfo0, err0 := callAdtrGetInner(ctx, c, logId, epoch)
 		adtrInfo = adtrInfo0
-		err = err0
+		return err0
+	})
+	if err {
+		return nil, true
 	}
-	return adtrInfo
+	return adtrInfo, false
 }
 
-func callAdtrGetInner(c *advrpc.Client, epoch uint64) (*AdtrEpochInfo, bool) {
-	arg := &AdtrGetArg{Epoch: epoch}
+func callAdtrGetInner(ctx context.Context, c *advrpc.Client, logId []byte, epoch uint64) (*AdtrEpochInfo, bool) {
+	arg := &AdtrGetArg{Version: ProtoVersion, LogId: logId, Epoch: epoch}
 	argByt := AdtrGetArgEncode(make([]byte, 0), arg)
 	replyByt := new([]byte)
-	var err0 = true
-	for err0 {
-		err0 = c.Call(AdtrGetRpc, argByt, replyByt)
+	if c.CallCtx(ctx, AdtrGetRpc, argByt, replyByt) {
+		return nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, true
 	}
 	reply, _, err1 := AdtrGetReplyDecode(*replyByt)
 	if err1 {
@@ -185,3 +401,105 @@ func callAdtrGetInner(c *advrpc.Client, epoch uint64) (*AdtrEpochInfo, bool) {
 	}
 	return reply.X, reply.Err
 }
+
+// retry runs f until it succeeds, sleeping with exponential backoff
+// between tries. it errors after maxCallTries, or once ctx is done.
+func retry(ctx context.Context, f func() bool) bool {
+	var sleep = callBackoff
+	var i uint64
+	for ; i < maxCallTries; i++ {
+		if i != 0 {
+			if sleepCtx(ctx, sleep) {
+				return true
+			}
+			sleep *= 2
+		}
+		if !f() {
+			return false
+		}
+	}
+	return true
+}
+
+// callRetry does an idempotent call, with the retries of retry.
+// this rides out brief net failures, with the advrpc timeout and
+// reconnect making progress.
+func callRetry(ctx context.Context, c *advrpc.Client, rpcId uint64, args []byte, reply *[]byte) bool {
+	return retry(ctx, func() bool {
+		return c.CallCtx(ctx, rpcId, args, reply)
+	})
+}
+
+// sleepCtx sleeps for d nanoseconds, and errors if ctx is done first.
+func sleepCtx(ctx context.Context, d uint64) bool {
+	t := time.NewTimer(time.Duration(d))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return false
+	case <-ctx.Done():
+		return true
+	}
+}
+
+// checkArgVersion errors if arg isn't from our ProtoVersion.
+// on a version mismatch, it replies with just our version,
+// which lets the client fail cleanly.
+func checkArgVersion(arg []byte, reply *[]byte) bool {
+	ver, _, err0 := marshalutil.ReadInt(arg)
+	if err0 {
+		return true
+	}
+	if ver != ProtoVersion {
+		*reply = marshal.WriteInt(*reply, ProtoVersion)
+		return true
+	}
+	return false
+}
+
+// checkReplyVersion errors if reply isn't from our ProtoVersion.
+func checkReplyVersion(reply []byte) bool {
+	ver, _, err0 := marshalutil.ReadInt(reply)
+	if err0 {
+		return true
+	}
+	return ver != ProtoVersion
+}
+
+// CallAdtrGetMany is like CallAdtrGet, for each of epochs.
+// there must be at most maxAdtrGetMany.
+func CallAdtrGetMany(ctx context.Context, c *advrpc.Client, logId []byte, epochs []uint64) ([]*AdtrEpochInfo, bool) {
+	var adtrInfos []*AdtrEpochInfo
+	err := retry(ctx, func() bool {
+		adtrInfos0, err0 := callAdtrGetManyInner(ctx, c, logId, epochs)
+		adtrInfos = adtrInfos0
+		return err0
+	})
+	if err {
+		return nil, true
+	}
+	return adtrInfos, false
+}
+
+func callAdtrGetManyInner(ctx context.Context, c *advrpc.Client, logId []byte, epochs []uint64) ([]*AdtrEpochInfo, bool) {
+	arg := &AdtrGetManyArg{Version: ProtoVersion, LogId: logId, Epochs: epochs}
+	argByt := AdtrGetManyArgEncode(make([]byte, 0), arg)
+	replyByt := new([]byte)
+	if c.CallCtx(ctx, AdtrGetManyRpc, argByt, replyByt) {
+		return nil, true
+	}
+	if checkReplyVersion(*replyByt) {
+		return nil, true
+	}
+	reply, _, err1 := AdtrGetManyReplyDecode(*replyByt)
+	if err1 {
+		return nil, true
+	}
+	if reply.Err {
+		return nil, true
+	}
+	if len(reply.Xs) != len(epochs) {
+		return nil, true
+	}
+	return reply.Xs, false
+}
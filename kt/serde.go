@@ -9,6 +9,31 @@ type SigDig struct {
 	Epoch uint64
 	Dig   []byte
 	Sig   []byte
+	// Cosigs are auditor sigs over the dig, which the server collected.
+	// they aren't covered by Sig.
+	Cosigs []*Cosig
+}
+
+// Cosig is an auditor's sig over a PreSigAdtrDig.
+type Cosig struct {
+	AdtrPk []byte
+	Sig    []byte
+}
+
+// PreSigParams are the server's long-lived public params.
+// the trailing SigPk keeps its encoding from ever parsing as a PreSigDig,
+// so a params sig can't pose as a dig sig.
+type PreSigParams struct {
+	HashSuite uint64
+	VrfPk     []byte
+	SigPk     []byte
+}
+
+type SigParams struct {
+	HashSuite uint64
+	VrfPk     []byte
+	SigPk     []byte
+	Sig       []byte
 }
 
 type MapLabelPre struct {
@@ -26,6 +51,20 @@ type MapValPre struct {
 	PkCommit []byte
 }
 
+// MapLatestLabelPre is the vrf input for a uid's latest label, which the
+// server re-commits on each put. it's shorter than MapLabelPre,
+// so the two never collide.
+type MapLatestLabelPre struct {
+	Uid uint64
+}
+
+// MapLatestValPre is the map val for a uid's latest label.
+// unlike MapValPre, it has no epoch, which hides when the latest version
+// was added. auditors let the server update it.
+type MapLatestValPre struct {
+	PkCommit []byte
+}
+
 type Memb struct {
 	LabelProof  []byte
 	EpochAdded  uint64
@@ -44,63 +83,161 @@ type NonMemb struct {
 	MerkleProof []byte
 }
 
+// LatestProof proves a uid's latest label. if the uid is registered,
+// the label is in the map, committing to PkOpen. otherwise,
+// it's not in the map, and PkOpen is empty.
+type LatestProof struct {
+	LabelProof  []byte
+	PkOpen      *CommitOpen
+	MerkleProof []byte
+}
+
+// rpc messages start with the sender's ProtoVersion, which lets
+// peers on different versions fail cleanly instead of misdecoding.
+
 type ServerPutArg struct {
-	Uid uint64
-	Pk  []byte
+	Version uint64
+	Uid     uint64
+	Pk      []byte
 }
 
 type ServerPutReply struct {
-	Dig    *SigDig
-	Latest *Memb
-	Bound  *NonMemb
-	Err    bool
+	Version uint64
+	Dig     *SigDig
+	Latest  *Memb
+	Bound   *NonMemb
+	Err     bool
+}
+
+// Caller identifies who's making a lookup, for the server's Authorizer.
+// Cred is, e.g., a session token from the operator's login service.
+type Caller struct {
+	Uid  uint64
+	Cred []byte
 }
 
 type ServerGetArg struct {
-	Uid uint64
+	Version uint64
+	Uid     uint64
+	Caller  *Caller
 }
 
+// ServerGetReply has Err if the server's Authorizer denied the lookup.
 type ServerGetReply struct {
-	Dig    *SigDig
-	Hist   []*MembHide
-	IsReg  bool
-	Latest *Memb
-	Bound  *NonMemb
+	Version uint64
+	Dig     *SigDig
+	Hist    []*MembHide
+	IsReg   bool
+	Latest  *Memb
+	Bound   *NonMemb
+	Err     bool
+}
+
+type ServerGetLatestArg struct {
+	Version uint64
+	Uid     uint64
+	Caller  *Caller
+}
+
+// ServerGetLatestReply is like ServerGetReply, but it only proves the
+// latest label, which hides the number of versions.
+type ServerGetLatestReply struct {
+	Version uint64
+	Dig     *SigDig
+	IsReg   bool
+	Latest  *LatestProof
+	Err     bool
 }
 
 type ServerSelfMonArg struct {
-	Uid uint64
+	Version uint64
+	Uid     uint64
+	Caller  *Caller
 }
 
 type ServerSelfMonReply struct {
-	Dig   *SigDig
-	Bound *NonMemb
+	Version uint64
+	Dig     *SigDig
+	Bound   *NonMemb
+	Latest  *LatestProof
+	Err     bool
 }
 
 type ServerAuditArg struct {
-	Epoch uint64
+	Version uint64
+	Epoch   uint64
 }
 
+// UpdateProof has an epoch's map updates and the server's signed dig
+// of the map after them.
+// UpdSig is the server's sig vouching that Updates make Dig,
+// which lets auditors give evid on a mismatch.
 type UpdateProof struct {
 	Updates map[string][]byte
+	Dig     []byte
 	Sig     []byte
+	UpdSig  []byte
 }
 
 type ServerAuditReply struct {
-	P   *UpdateProof
-	Err bool
+	Version uint64
+	P       *UpdateProof
+	Err     bool
 }
 
+// ServerAuditRangeArg asks for up to Limit epochs, starting at Start.
+type ServerAuditRangeArg struct {
+	Version uint64
+	Start   uint64
+	Limit   uint64
+}
+
+// ServerAuditRangeReply has the proofs for epochs [Start, Next).
+// Next is the continuation token for the following call.
+type ServerAuditRangeReply struct {
+	Version uint64
+	Ps      []*UpdateProof
+	Next    uint64
+	Err     bool
+}
+
+// auditors keep a log per server, and a log's id is its server's sig pk.
 type AdtrUpdateArg struct {
-	P *UpdateProof
+	Version uint64
+	LogId   []byte
+	P       *UpdateProof
 }
 
+// AdtrUpdateReply has evid if the server's updates didn't match its dig.
+// Evid is all empty if not.
 type AdtrUpdateReply struct {
-	Err bool
+	Version uint64
+	Evid    *UpdEvid
+	Err     bool
+}
+
+// UpdEvid is evidence that the server signed a dig that doesn't match
+// the updates it vouched for in that epoch.
+// anyone with the map through the prior epoch, e.g., another auditor,
+// can confirm it by applying Updates and comparing against ServDig.
+type UpdEvid struct {
+	ServDig *SigDig
+	Updates map[string][]byte
+	UpdSig  []byte
 }
 
 type AdtrGetArg struct {
+	Version uint64
+	LogId   []byte
+	Epoch   uint64
+}
+
+// PreSigAdtrDig is what an auditor signs. the log id keeps a sig for one
+// server's dig from posing as a sig for another's.
+type PreSigAdtrDig struct {
+	LogId []byte
 	Epoch uint64
+	Dig   []byte
 }
 
 type AdtrEpochInfo struct {
@@ -110,6 +247,15 @@ type AdtrEpochInfo struct {
 }
 
 type AdtrGetReply struct {
-	X   *AdtrEpochInfo
-	Err bool
+	Version uint64
+	X       *AdtrEpochInfo
+	Err     bool
+}
+
+// AdtrGetManyArg is in serde_misc.go, since serde doesn't support []uint64.
+
+type AdtrGetManyReply struct {
+	Version uint64
+	Xs      []*AdtrEpochInfo
+	Err     bool
 }
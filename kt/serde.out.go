@@ -29,6 +29,7 @@ func SigDigEncode(b0 []byte, o *SigDig) []byte {
 	b = marshal.WriteInt(b, o.Epoch)
 	b = marshalutil.WriteSlice1D(b, o.Dig)
 	b = marshalutil.WriteSlice1D(b, o.Sig)
+	b = CosigSlice1DEncode(b, o.Cosigs)
 	return b
 }
 func SigDigDecode(b0 []byte) (*SigDig, []byte, bool) {
@@ -44,7 +45,77 @@ func SigDigDecode(b0 []byte) (*SigDig, []byte, bool) {
 	if err3 {
 		return nil, nil, true
 	}
-	return &SigDig{Epoch: a1, Dig: a2, Sig: a3}, b3, false
+	a4, b4, err4 := CosigSlice1DDecode(b3)
+	if err4 {
+		return nil, nil, true
+	}
+	return &SigDig{Epoch: a1, Dig: a2, Sig: a3, Cosigs: a4}, b4, false
+}
+func CosigEncode(b0 []byte, o *Cosig) []byte {
+	var b = b0
+	b = marshalutil.WriteSlice1D(b, o.AdtrPk)
+	b = marshalutil.WriteSlice1D(b, o.Sig)
+	return b
+}
+func CosigDecode(b0 []byte) (*Cosig, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadSlice1D(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	return &Cosig{AdtrPk: a1, Sig: a2}, b2, false
+}
+func PreSigParamsEncode(b0 []byte, o *PreSigParams) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.HashSuite)
+	b = marshalutil.WriteSlice1D(b, o.VrfPk)
+	b = marshalutil.WriteSlice1D(b, o.SigPk)
+	return b
+}
+func PreSigParamsDecode(b0 []byte) (*PreSigParams, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadSlice1D(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &PreSigParams{HashSuite: a1, VrfPk: a2, SigPk: a3}, b3, false
+}
+func SigParamsEncode(b0 []byte, o *SigParams) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.HashSuite)
+	b = marshalutil.WriteSlice1D(b, o.VrfPk)
+	b = marshalutil.WriteSlice1D(b, o.SigPk)
+	b = marshalutil.WriteSlice1D(b, o.Sig)
+	return b
+}
+func SigParamsDecode(b0 []byte) (*SigParams, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadSlice1D(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	a4, b4, err4 := marshalutil.ReadSlice1D(b3)
+	if err4 {
+		return nil, nil, true
+	}
+	return &SigParams{HashSuite: a1, VrfPk: a2, SigPk: a3, Sig: a4}, b4, false
 }
 func MapLabelPreEncode(b0 []byte, o *MapLabelPre) []byte {
 	var b = b0
@@ -97,6 +168,30 @@ func MapValPreDecode(b0 []byte) (*MapValPre, []byte, bool) {
 	}
 	return &MapValPre{Epoch: a1, PkCommit: a2}, b2, false
 }
+func MapLatestLabelPreEncode(b0 []byte, o *MapLatestLabelPre) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Uid)
+	return b
+}
+func MapLatestLabelPreDecode(b0 []byte) (*MapLatestLabelPre, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	return &MapLatestLabelPre{Uid: a1}, b1, false
+}
+func MapLatestValPreEncode(b0 []byte, o *MapLatestValPre) []byte {
+	var b = b0
+	b = marshalutil.WriteSlice1D(b, o.PkCommit)
+	return b
+}
+func MapLatestValPreDecode(b0 []byte) (*MapLatestValPre, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadSlice1D(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	return &MapLatestValPre{PkCommit: a1}, b1, false
+}
 func MembEncode(b0 []byte, o *Memb) []byte {
 	var b = b0
 	b = marshalutil.WriteSlice1D(b, o.LabelProof)
@@ -163,8 +258,31 @@ func NonMembDecode(b0 []byte) (*NonMemb, []byte, bool) {
 	}
 	return &NonMemb{LabelProof: a1, MerkleProof: a2}, b2, false
 }
+func LatestProofEncode(b0 []byte, o *LatestProof) []byte {
+	var b = b0
+	b = marshalutil.WriteSlice1D(b, o.LabelProof)
+	b = CommitOpenEncode(b, o.PkOpen)
+	b = marshalutil.WriteSlice1D(b, o.MerkleProof)
+	return b
+}
+func LatestProofDecode(b0 []byte) (*LatestProof, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadSlice1D(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := CommitOpenDecode(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadSlice1D(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &LatestProof{LabelProof: a1, PkOpen: a2, MerkleProof: a3}, b3, false
+}
 func ServerPutArgEncode(b0 []byte, o *ServerPutArg) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = marshal.WriteInt(b, o.Uid)
 	b = marshalutil.WriteSlice1D(b, o.Pk)
 	return b
@@ -174,14 +292,19 @@ func ServerPutArgDecode(b0 []byte) (*ServerPutArg, []byte, bool) {
 	if err1 {
 		return nil, nil, true
 	}
-	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	a2, b2, err2 := marshalutil.ReadInt(b1)
 	if err2 {
 		return nil, nil, true
 	}
-	return &ServerPutArg{Uid: a1, Pk: a2}, b2, false
+	a3, b3, err3 := marshalutil.ReadSlice1D(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &ServerPutArg{Version: a1, Uid: a2, Pk: a3}, b3, false
 }
 func ServerPutReplyEncode(b0 []byte, o *ServerPutReply) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = SigDigEncode(b, o.Dig)
 	b = MembEncode(b, o.Latest)
 	b = NonMembEncode(b, o.Bound)
@@ -189,27 +312,50 @@ func ServerPutReplyEncode(b0 []byte, o *ServerPutReply) []byte {
 	return b
 }
 func ServerPutReplyDecode(b0 []byte) (*ServerPutReply, []byte, bool) {
-	a1, b1, err1 := SigDigDecode(b0)
+	a1, b1, err1 := marshalutil.ReadInt(b0)
 	if err1 {
 		return nil, nil, true
 	}
-	a2, b2, err2 := MembDecode(b1)
+	a2, b2, err2 := SigDigDecode(b1)
 	if err2 {
 		return nil, nil, true
 	}
-	a3, b3, err3 := NonMembDecode(b2)
+	a3, b3, err3 := MembDecode(b2)
 	if err3 {
 		return nil, nil, true
 	}
-	a4, b4, err4 := marshalutil.ReadBool(b3)
+	a4, b4, err4 := NonMembDecode(b3)
 	if err4 {
 		return nil, nil, true
 	}
-	return &ServerPutReply{Dig: a1, Latest: a2, Bound: a3, Err: a4}, b4, false
+	a5, b5, err5 := marshalutil.ReadBool(b4)
+	if err5 {
+		return nil, nil, true
+	}
+	return &ServerPutReply{Version: a1, Dig: a2, Latest: a3, Bound: a4, Err: a5}, b5, false
+}
+func CallerEncode(b0 []byte, o *Caller) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Uid)
+	b = marshalutil.WriteSlice1D(b, o.Cred)
+	return b
+}
+func CallerDecode(b0 []byte) (*Caller, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	return &Caller{Uid: a1, Cred: a2}, b2, false
 }
 func ServerGetArgEncode(b0 []byte, o *ServerGetArg) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = marshal.WriteInt(b, o.Uid)
+	b = CallerEncode(b, o.Caller)
 	return b
 }
 func ServerGetArgDecode(b0 []byte) (*ServerGetArg, []byte, bool) {
@@ -217,23 +363,95 @@ func ServerGetArgDecode(b0 []byte) (*ServerGetArg, []byte, bool) {
 	if err1 {
 		return nil, nil, true
 	}
-	return &ServerGetArg{Uid: a1}, b1, false
+	a2, b2, err2 := marshalutil.ReadInt(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := CallerDecode(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &ServerGetArg{Version: a1, Uid: a2, Caller: a3}, b3, false
 }
 func ServerGetReplyEncode(b0 []byte, o *ServerGetReply) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = SigDigEncode(b, o.Dig)
 	b = MembHideSlice1DEncode(b, o.Hist)
 	b = marshal.WriteBool(b, o.IsReg)
 	b = MembEncode(b, o.Latest)
 	b = NonMembEncode(b, o.Bound)
+	b = marshal.WriteBool(b, o.Err)
 	return b
 }
 func ServerGetReplyDecode(b0 []byte) (*ServerGetReply, []byte, bool) {
-	a1, b1, err1 := SigDigDecode(b0)
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := SigDigDecode(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := MembHideSlice1DDecode(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	a4, b4, err4 := marshalutil.ReadBool(b3)
+	if err4 {
+		return nil, nil, true
+	}
+	a5, b5, err5 := MembDecode(b4)
+	if err5 {
+		return nil, nil, true
+	}
+	a6, b6, err6 := NonMembDecode(b5)
+	if err6 {
+		return nil, nil, true
+	}
+	a7, b7, err7 := marshalutil.ReadBool(b6)
+	if err7 {
+		return nil, nil, true
+	}
+	return &ServerGetReply{Version: a1, Dig: a2, Hist: a3, IsReg: a4, Latest: a5, Bound: a6, Err: a7}, b7, false
+}
+func ServerGetLatestArgEncode(b0 []byte, o *ServerGetLatestArg) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = marshal.WriteInt(b, o.Uid)
+	b = CallerEncode(b, o.Caller)
+	return b
+}
+func ServerGetLatestArgDecode(b0 []byte) (*ServerGetLatestArg, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
 	if err1 {
 		return nil, nil, true
 	}
-	a2, b2, err2 := MembHideSlice1DDecode(b1)
+	a2, b2, err2 := marshalutil.ReadInt(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := CallerDecode(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &ServerGetLatestArg{Version: a1, Uid: a2, Caller: a3}, b3, false
+}
+func ServerGetLatestReplyEncode(b0 []byte, o *ServerGetLatestReply) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = SigDigEncode(b, o.Dig)
+	b = marshal.WriteBool(b, o.IsReg)
+	b = LatestProofEncode(b, o.Latest)
+	b = marshal.WriteBool(b, o.Err)
+	return b
+}
+func ServerGetLatestReplyDecode(b0 []byte) (*ServerGetLatestReply, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := SigDigDecode(b1)
 	if err2 {
 		return nil, nil, true
 	}
@@ -241,19 +459,21 @@ func ServerGetReplyDecode(b0 []byte) (*ServerGetReply, []byte, bool) {
 	if err3 {
 		return nil, nil, true
 	}
-	a4, b4, err4 := MembDecode(b3)
+	a4, b4, err4 := LatestProofDecode(b3)
 	if err4 {
 		return nil, nil, true
 	}
-	a5, b5, err5 := NonMembDecode(b4)
+	a5, b5, err5 := marshalutil.ReadBool(b4)
 	if err5 {
 		return nil, nil, true
 	}
-	return &ServerGetReply{Dig: a1, Hist: a2, IsReg: a3, Latest: a4, Bound: a5}, b5, false
+	return &ServerGetLatestReply{Version: a1, Dig: a2, IsReg: a3, Latest: a4, Err: a5}, b5, false
 }
 func ServerSelfMonArgEncode(b0 []byte, o *ServerSelfMonArg) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = marshal.WriteInt(b, o.Uid)
+	b = CallerEncode(b, o.Caller)
 	return b
 }
 func ServerSelfMonArgDecode(b0 []byte) (*ServerSelfMonArg, []byte, bool) {
@@ -261,27 +481,51 @@ func ServerSelfMonArgDecode(b0 []byte) (*ServerSelfMonArg, []byte, bool) {
 	if err1 {
 		return nil, nil, true
 	}
-	return &ServerSelfMonArg{Uid: a1}, b1, false
+	a2, b2, err2 := marshalutil.ReadInt(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := CallerDecode(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &ServerSelfMonArg{Version: a1, Uid: a2, Caller: a3}, b3, false
 }
 func ServerSelfMonReplyEncode(b0 []byte, o *ServerSelfMonReply) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = SigDigEncode(b, o.Dig)
 	b = NonMembEncode(b, o.Bound)
+	b = LatestProofEncode(b, o.Latest)
+	b = marshal.WriteBool(b, o.Err)
 	return b
 }
 func ServerSelfMonReplyDecode(b0 []byte) (*ServerSelfMonReply, []byte, bool) {
-	a1, b1, err1 := SigDigDecode(b0)
+	a1, b1, err1 := marshalutil.ReadInt(b0)
 	if err1 {
 		return nil, nil, true
 	}
-	a2, b2, err2 := NonMembDecode(b1)
+	a2, b2, err2 := SigDigDecode(b1)
 	if err2 {
 		return nil, nil, true
 	}
-	return &ServerSelfMonReply{Dig: a1, Bound: a2}, b2, false
+	a3, b3, err3 := NonMembDecode(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	a4, b4, err4 := LatestProofDecode(b3)
+	if err4 {
+		return nil, nil, true
+	}
+	a5, b5, err5 := marshalutil.ReadBool(b4)
+	if err5 {
+		return nil, nil, true
+	}
+	return &ServerSelfMonReply{Version: a1, Dig: a2, Bound: a3, Latest: a4, Err: a5}, b5, false
 }
 func ServerAuditArgEncode(b0 []byte, o *ServerAuditArg) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = marshal.WriteInt(b, o.Epoch)
 	return b
 }
@@ -290,12 +534,18 @@ func ServerAuditArgDecode(b0 []byte) (*ServerAuditArg, []byte, bool) {
 	if err1 {
 		return nil, nil, true
 	}
-	return &ServerAuditArg{Epoch: a1}, b1, false
+	a2, b2, err2 := marshalutil.ReadInt(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	return &ServerAuditArg{Version: a1, Epoch: a2}, b2, false
 }
 func UpdateProofEncode(b0 []byte, o *UpdateProof) []byte {
 	var b = b0
 	b = MapstringSlbyteEncode(b, o.Updates)
+	b = marshalutil.WriteSlice1D(b, o.Dig)
 	b = marshalutil.WriteSlice1D(b, o.Sig)
+	b = marshalutil.WriteSlice1D(b, o.UpdSig)
 	return b
 }
 func UpdateProofDecode(b0 []byte) (*UpdateProof, []byte, bool) {
@@ -307,51 +557,157 @@ func UpdateProofDecode(b0 []byte) (*UpdateProof, []byte, bool) {
 	if err2 {
 		return nil, nil, true
 	}
-	return &UpdateProof{Updates: a1, Sig: a2}, b2, false
+	a3, b3, err3 := marshalutil.ReadSlice1D(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	a4, b4, err4 := marshalutil.ReadSlice1D(b3)
+	if err4 {
+		return nil, nil, true
+	}
+	return &UpdateProof{Updates: a1, Dig: a2, Sig: a3, UpdSig: a4}, b4, false
 }
 func ServerAuditReplyEncode(b0 []byte, o *ServerAuditReply) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = UpdateProofEncode(b, o.P)
 	b = marshal.WriteBool(b, o.Err)
 	return b
 }
 func ServerAuditReplyDecode(b0 []byte) (*ServerAuditReply, []byte, bool) {
-	a1, b1, err1 := UpdateProofDecode(b0)
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := UpdateProofDecode(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadBool(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &ServerAuditReply{Version: a1, P: a2, Err: a3}, b3, false
+}
+func ServerAuditRangeArgEncode(b0 []byte, o *ServerAuditRangeArg) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = marshal.WriteInt(b, o.Start)
+	b = marshal.WriteInt(b, o.Limit)
+	return b
+}
+func ServerAuditRangeArgDecode(b0 []byte) (*ServerAuditRangeArg, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
 	if err1 {
 		return nil, nil, true
 	}
-	a2, b2, err2 := marshalutil.ReadBool(b1)
+	a2, b2, err2 := marshalutil.ReadInt(b1)
 	if err2 {
 		return nil, nil, true
 	}
-	return &ServerAuditReply{P: a1, Err: a2}, b2, false
+	a3, b3, err3 := marshalutil.ReadInt(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &ServerAuditRangeArg{Version: a1, Start: a2, Limit: a3}, b3, false
+}
+func ServerAuditRangeReplyEncode(b0 []byte, o *ServerAuditRangeReply) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = UpdateProofSlice1DEncode(b, o.Ps)
+	b = marshal.WriteInt(b, o.Next)
+	b = marshal.WriteBool(b, o.Err)
+	return b
+}
+func ServerAuditRangeReplyDecode(b0 []byte) (*ServerAuditRangeReply, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := UpdateProofSlice1DDecode(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadInt(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	a4, b4, err4 := marshalutil.ReadBool(b3)
+	if err4 {
+		return nil, nil, true
+	}
+	return &ServerAuditRangeReply{Version: a1, Ps: a2, Next: a3, Err: a4}, b4, false
 }
 func AdtrUpdateArgEncode(b0 []byte, o *AdtrUpdateArg) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = marshalutil.WriteSlice1D(b, o.LogId)
 	b = UpdateProofEncode(b, o.P)
 	return b
 }
 func AdtrUpdateArgDecode(b0 []byte) (*AdtrUpdateArg, []byte, bool) {
-	a1, b1, err1 := UpdateProofDecode(b0)
+	a1, b1, err1 := marshalutil.ReadInt(b0)
 	if err1 {
 		return nil, nil, true
 	}
-	return &AdtrUpdateArg{P: a1}, b1, false
+	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := UpdateProofDecode(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &AdtrUpdateArg{Version: a1, LogId: a2, P: a3}, b3, false
 }
 func AdtrUpdateReplyEncode(b0 []byte, o *AdtrUpdateReply) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = UpdEvidEncode(b, o.Evid)
 	b = marshal.WriteBool(b, o.Err)
 	return b
 }
 func AdtrUpdateReplyDecode(b0 []byte) (*AdtrUpdateReply, []byte, bool) {
-	a1, b1, err1 := marshalutil.ReadBool(b0)
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := UpdEvidDecode(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadBool(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &AdtrUpdateReply{Version: a1, Evid: a2, Err: a3}, b3, false
+}
+func UpdEvidEncode(b0 []byte, o *UpdEvid) []byte {
+	var b = b0
+	b = SigDigEncode(b, o.ServDig)
+	b = MapstringSlbyteEncode(b, o.Updates)
+	b = marshalutil.WriteSlice1D(b, o.UpdSig)
+	return b
+}
+func UpdEvidDecode(b0 []byte) (*UpdEvid, []byte, bool) {
+	a1, b1, err1 := SigDigDecode(b0)
 	if err1 {
 		return nil, nil, true
 	}
-	return &AdtrUpdateReply{Err: a1}, b1, false
+	a2, b2, err2 := MapstringSlbyteDecode(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadSlice1D(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &UpdEvid{ServDig: a1, Updates: a2, UpdSig: a3}, b3, false
 }
 func AdtrGetArgEncode(b0 []byte, o *AdtrGetArg) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = marshalutil.WriteSlice1D(b, o.LogId)
 	b = marshal.WriteInt(b, o.Epoch)
 	return b
 }
@@ -360,7 +716,37 @@ func AdtrGetArgDecode(b0 []byte) (*AdtrGetArg, []byte, bool) {
 	if err1 {
 		return nil, nil, true
 	}
-	return &AdtrGetArg{Epoch: a1}, b1, false
+	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadInt(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &AdtrGetArg{Version: a1, LogId: a2, Epoch: a3}, b3, false
+}
+func PreSigAdtrDigEncode(b0 []byte, o *PreSigAdtrDig) []byte {
+	var b = b0
+	b = marshalutil.WriteSlice1D(b, o.LogId)
+	b = marshal.WriteInt(b, o.Epoch)
+	b = marshalutil.WriteSlice1D(b, o.Dig)
+	return b
+}
+func PreSigAdtrDigDecode(b0 []byte) (*PreSigAdtrDig, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadSlice1D(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := marshalutil.ReadInt(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadSlice1D(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &PreSigAdtrDig{LogId: a1, Epoch: a2, Dig: a3}, b3, false
 }
 func AdtrEpochInfoEncode(b0 []byte, o *AdtrEpochInfo) []byte {
 	var b = b0
@@ -386,18 +772,45 @@ func AdtrEpochInfoDecode(b0 []byte) (*AdtrEpochInfo, []byte, bool) {
 }
 func AdtrGetReplyEncode(b0 []byte, o *AdtrGetReply) []byte {
 	var b = b0
+	b = marshal.WriteInt(b, o.Version)
 	b = AdtrEpochInfoEncode(b, o.X)
 	b = marshal.WriteBool(b, o.Err)
 	return b
 }
 func AdtrGetReplyDecode(b0 []byte) (*AdtrGetReply, []byte, bool) {
-	a1, b1, err1 := AdtrEpochInfoDecode(b0)
+	a1, b1, err1 := marshalutil.ReadInt(b0)
 	if err1 {
 		return nil, nil, true
 	}
-	a2, b2, err2 := marshalutil.ReadBool(b1)
+	a2, b2, err2 := AdtrEpochInfoDecode(b1)
 	if err2 {
 		return nil, nil, true
 	}
-	return &AdtrGetReply{X: a1, Err: a2}, b2, false
+	a3, b3, err3 := marshalutil.ReadBool(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &AdtrGetReply{Version: a1, X: a2, Err: a3}, b3, false
+}
+func AdtrGetManyReplyEncode(b0 []byte, o *AdtrGetManyReply) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = AdtrEpochInfoSlice1DEncode(b, o.Xs)
+	b = marshal.WriteBool(b, o.Err)
+	return b
+}
+func AdtrGetManyReplyDecode(b0 []byte) (*AdtrGetManyReply, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := AdtrEpochInfoSlice1DDecode(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	a3, b3, err3 := marshalutil.ReadBool(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	return &AdtrGetManyReply{Version: a1, Xs: a2, Err: a3}, b3, false
 }
@@ -37,6 +37,155 @@ func MembHideSlice1DDecode(b0 []byte) ([]*MembHide, []byte, bool) {
 	return loopO, loopB, false
 }
 
+func UpdateProofSlice1DEncode(b0 []byte, o []*UpdateProof) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, uint64(len(o)))
+	for _, e := range o {
+		b = UpdateProofEncode(b, e)
+	}
+	return b
+}
+
+func UpdateProofSlice1DDecode(b0 []byte) ([]*UpdateProof, []byte, bool) {
+	length, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	// no pre-alloc, since the adversary controls length.
+	var loopO []*UpdateProof
+	var loopErr bool
+	var loopB = b1
+	for i := uint64(0); i < length; i++ {
+		a2, loopB1, err2 := UpdateProofDecode(loopB)
+		loopB = loopB1
+		if err2 {
+			loopErr = true
+			break
+		}
+		loopO = append(loopO, a2)
+	}
+	if loopErr {
+		return nil, nil, true
+	}
+	return loopO, loopB, false
+}
+
+func CosigSlice1DEncode(b0 []byte, o []*Cosig) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, uint64(len(o)))
+	for _, e := range o {
+		b = CosigEncode(b, e)
+	}
+	return b
+}
+
+func CosigSlice1DDecode(b0 []byte) ([]*Cosig, []byte, bool) {
+	length, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	// no pre-alloc, since the adversary controls length.
+	var loopO []*Cosig
+	var loopErr bool
+	var loopB = b1
+	for i := uint64(0); i < length; i++ {
+		a2, loopB1, err2 := CosigDecode(loopB)
+		loopB = loopB1
+		if err2 {
+			loopErr = true
+			break
+		}
+		loopO = append(loopO, a2)
+	}
+	if loopErr {
+		return nil, nil, true
+	}
+	return loopO, loopB, false
+}
+
+func AdtrEpochInfoSlice1DEncode(b0 []byte, o []*AdtrEpochInfo) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, uint64(len(o)))
+	for _, e := range o {
+		b = AdtrEpochInfoEncode(b, e)
+	}
+	return b
+}
+
+func AdtrEpochInfoSlice1DDecode(b0 []byte) ([]*AdtrEpochInfo, []byte, bool) {
+	length, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	// no pre-alloc, since the adversary controls length.
+	var loopO []*AdtrEpochInfo
+	var loopErr bool
+	var loopB = b1
+	for i := uint64(0); i < length; i++ {
+		a2, loopB1, err2 := AdtrEpochInfoDecode(loopB)
+		loopB = loopB1
+		if err2 {
+			loopErr = true
+			break
+		}
+		loopO = append(loopO, a2)
+	}
+	if loopErr {
+		return nil, nil, true
+	}
+	return loopO, loopB, false
+}
+
+// AdtrGetManyArg asks for the auditor's info for each of Epochs.
+type AdtrGetManyArg struct {
+	Version uint64
+	LogId   []byte
+	Epochs  []uint64
+}
+
+func AdtrGetManyArgEncode(b0 []byte, o *AdtrGetManyArg) []byte {
+	var b = b0
+	b = marshal.WriteInt(b, o.Version)
+	b = marshalutil.WriteSlice1D(b, o.LogId)
+	b = marshal.WriteInt(b, uint64(len(o.Epochs)))
+	for _, e := range o.Epochs {
+		b = marshal.WriteInt(b, e)
+	}
+	return b
+}
+
+func AdtrGetManyArgDecode(b0 []byte) (*AdtrGetManyArg, []byte, bool) {
+	a1, b1, err1 := marshalutil.ReadInt(b0)
+	if err1 {
+		return nil, nil, true
+	}
+	a2, b2, err2 := marshalutil.ReadSlice1D(b1)
+	if err2 {
+		return nil, nil, true
+	}
+	length, b3, err3 := marshalutil.ReadInt(b2)
+	if err3 {
+		return nil, nil, true
+	}
+	// no pre-alloc, since the adversary controls length.
+	var loopO []uint64
+	var loopErr bool
+	var loopB = b3
+	for i := uint64(0); i < length; i++ {
+		a4, loopB1, err4 := marshalutil.ReadInt(loopB)
+		loopB = loopB1
+		if err4 {
+			loopErr = true
+			break
+		}
+		loopO = append(loopO, a4)
+	}
+	if loopErr {
+		return nil, nil, true
+	}
+	return &AdtrGetManyArg{Version: a1, LogId: a2, Epochs: loopO}, loopB, false
+}
+
 func MapstringSlbyteEncode(b0 []byte, o map[string][]byte) []byte {
 	var b = b0
 	b = marshal.WriteInt(b, uint64(len(o)))
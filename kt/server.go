@@ -1,9 +1,12 @@
 package kt
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/goose-lang/std"
+	"github.com/mit-pdos/pav/advrpc"
 	"github.com/mit-pdos/pav/cryptoffi"
 	"github.com/mit-pdos/pav/cryptoutil"
 	"github.com/mit-pdos/pav/merkle"
@@ -13,6 +16,10 @@ type Server struct {
 	mu    *sync.RWMutex
 	sigSk *cryptoffi.SigPrivateKey
 	vrfSk *cryptoffi.VrfPrivateKey
+	// suite is the hash suite for keyMap and commitments.
+	suite uint64
+	// params is the signed record of suite and the server's pks.
+	params *SigParams
 	// commitSecret is the 32-byte secret used to generate commitments.
 	commitSecret []byte
 	// keyMap stores (mapLabel, mapVal) entries.
@@ -23,8 +30,48 @@ type Server struct {
 	epochHist []*servEpochInfo
 	// workQ batch processes Put requests.
 	workQ *WorkQ
+	// workerDone gets closed once the worker thread exits.
+	workerDone chan struct{}
+	// epochCh gets closed, and replaced, on each new epoch.
+	// it lets AuditWait block without polling.
+	epochCh chan struct{}
+	// closed gets closed by Close, which ends pending AuditWaits.
+	closed chan struct{}
+	// closing is set by the first Close, so that later ones do nothing.
+	closing bool
+	// cosigners are auditors that cosign each new epoch.
+	cosigners []*cosigner
 }
 
+// cosigner is an auditor that the server pushes updates to.
+type cosigner struct {
+	// mu protects next, and serializes the calls to the auditor.
+	mu  *sync.Mutex
+	cli *advrpc.Client
+	pk  cryptoffi.SigPublicKey
+	// next is the next epoch that the auditor needs.
+	next uint64
+}
+
+const (
+	// maxAuditRange bounds the epochs in an AuditRange reply.
+	maxAuditRange uint64 = 1024
+	// maxAuditRangeBytes bounds the encoded proofs in an AuditRange reply,
+	// well below the advrpc frame limit.
+	maxAuditRangeBytes uint64 = 1 << 24
+	// cosignTimeout bounds each auditor's cosign of an epoch,
+	// in nanoseconds.
+	cosignTimeout uint64 = 1_000_000_000
+	// keptSnaps bounds the keyMap snapshots that the server keeps,
+	// so that memory doesn't grow with old epochs' roots.
+	// ProveAt only works for this many recent epochs.
+	keptSnaps uint64 = 16
+	// auditWaitTimeout bounds AuditWait, in nanoseconds.
+	// it's below the advrpc call timeout, so long polls don't
+	// get mistaken for dead conns.
+	auditWaitTimeout uint64 = 5_000_000_000
+)
+
 type userState struct {
 	// numVers provides the authoritative number of registered versions,
 	// which corresponds to keyMap entries.
@@ -38,9 +85,13 @@ type servEpochInfo struct {
 	updates map[string][]byte
 	dig     []byte
 	sig     []byte
+	// updSig vouches that updates make dig.
+	updSig []byte
+	cosigs []*Cosig
 }
 
-// Put errors iff there's a put of the same uid at the same time.
+// Put errors iff there's a put of the same uid at the same time,
+// or, for a disk-backed server, if the key map's disk write fails.
 func (s *Server) Put(uid uint64, pk []byte) (*SigDig, *Memb, *NonMemb, bool) {
 	resp := s.workQ.Do(&WQReq{Uid: uid, Pk: pk})
 	return resp.Dig, resp.Lat, resp.Bound, resp.Err
@@ -49,6 +100,9 @@ func (s *Server) Put(uid uint64, pk []byte) (*SigDig, *Memb, *NonMemb, bool) {
 // Get returns a complete history proof for uid.
 // if uid is not yet registered, it returns an empty memb proof for
 // for the latest version.
+// the history reveals when uid added each version. NewRpcServerAuth and
+// NewHttpServerAuth only serve it to uid's owner, but without an
+// Authorizer, it's open to all.
 func (s *Server) Get(uid uint64) (*SigDig, []*MembHide, bool, *Memb, *NonMemb) {
 	s.mu.RLock()
 	user := s.userInfo[uid]
@@ -61,24 +115,54 @@ func (s *Server) Get(uid uint64) (*SigDig, []*MembHide, bool, *Memb, *NonMemb) {
 
 	dig := getDig(s.epochHist)
 	hist := getHist(s.keyMap, uid, numVers, s.vrfSk)
-	isReg, latest := getLatest(s.keyMap, uid, numVers, s.vrfSk, s.commitSecret, plainPk)
+	isReg, latest := getLatest(s.keyMap, s.suite, uid, numVers, s.vrfSk, s.commitSecret, plainPk)
 	bound := getBound(s.keyMap, uid, numVers, s.vrfSk)
 	s.mu.RUnlock()
 	return dig, hist, isReg, latest, bound
 }
 
-func (s *Server) SelfMon(uid uint64) (*SigDig, *NonMemb) {
+// GetLatest is like Get, but it only proves uid's latest label,
+// which each put re-commits to the new pk. unlike the versioned labels,
+// it hides the number of versions and when the latest was added.
+// the latest label is mutable, so only SelfMon at each epoch
+// catches the server changing it.
+func (s *Server) GetLatest(uid uint64) (*SigDig, bool, *LatestProof) {
 	s.mu.RLock()
 	user := s.userInfo[uid]
 	var numVers uint64
+	var plainPk []byte
 	if user != nil {
 		numVers = user.numVers
+		plainPk = user.plainPk
+	}
+
+	dig := getDig(s.epochHist)
+	latest := getLatestLabel(s.keyMap, s.suite, uid, numVers, s.vrfSk, s.commitSecret, plainPk)
+	s.mu.RUnlock()
+	return dig, numVers != 0, latest
+}
+
+// SelfMon returns uid's bound and latest label, for the owner to check.
+func (s *Server) SelfMon(uid uint64) (*SigDig, *NonMemb, *LatestProof) {
+	s.mu.RLock()
+	user := s.userInfo[uid]
+	var numVers uint64
+	var plainPk []byte
+	if user != nil {
+		numVers = user.numVers
+		plainPk = user.plainPk
 	}
 
 	dig := getDig(s.epochHist)
 	bound := getBound(s.keyMap, uid, numVers, s.vrfSk)
+	latest := getLatestLabel(s.keyMap, s.suite, uid, numVers, s.vrfSk, s.commitSecret, plainPk)
 	s.mu.RUnlock()
-	return dig, bound
+	return dig, bound, latest
+}
+
+// Params returns the server's signed params.
+func (s *Server) Params() *SigParams {
+	return s.params
 }
 
 // Audit returns an err on fail.
@@ -90,7 +174,76 @@ func (s *Server) Audit(epoch uint64) (*UpdateProof, bool) {
 	}
 	info := s.epochHist[epoch]
 	s.mu.RUnlock()
-	return &UpdateProof{Updates: info.updates, Sig: info.sig}, false
+	return &UpdateProof{Updates: info.updates, Dig: info.dig, Sig: info.sig, UpdSig: info.updSig}, false
+}
+
+// AuditRange returns the update proofs for up to limit epochs, starting at
+// start, and the epoch after the last one returned.
+// replies are also bounded by maxAuditRange and maxAuditRangeBytes,
+// but they always have at least one epoch, if start exists.
+// it errors if start is past the next epoch.
+func (s *Server) AuditRange(start, limit uint64) ([]*UpdateProof, uint64, bool) {
+	s.mu.RLock()
+	numEpochs := uint64(len(s.epochHist))
+	if start > numEpochs {
+		s.mu.RUnlock()
+		return nil, start, true
+	}
+	var maxN = limit
+	if maxN > maxAuditRange {
+		maxN = maxAuditRange
+	}
+	var ps []*UpdateProof
+	var sz uint64
+	var epoch = start
+	for epoch < numEpochs && uint64(len(ps)) < maxN {
+		info := s.epochHist[epoch]
+		p := &UpdateProof{Updates: info.updates, Dig: info.dig, Sig: info.sig, UpdSig: info.updSig}
+		pSz := updateProofSize(p)
+		if len(ps) != 0 && sz+pSz > maxAuditRangeBytes {
+			break
+		}
+		ps = append(ps, p)
+		sz += pSz
+		epoch++
+	}
+	s.mu.RUnlock()
+	return ps, epoch, false
+}
+
+// updateProofSize returns the encoded size of p.
+func updateProofSize(p *UpdateProof) uint64 {
+	var sz = uint64(8 + 8 + len(p.Dig) + 8 + len(p.Sig) + 8 + len(p.UpdSig))
+	for label, val := range p.Updates {
+		sz += uint64(8 + len(label) + 8 + len(val))
+	}
+	return sz
+}
+
+// AuditWait is like Audit, but if epoch doesn't exist yet, it waits for
+// the server to commit it. it errors if that takes too long.
+func (s *Server) AuditWait(epoch uint64) (*UpdateProof, bool) {
+	timer := time.NewTimer(time.Duration(auditWaitTimeout))
+	for {
+		s.mu.RLock()
+		if epoch < uint64(len(s.epochHist)) {
+			info := s.epochHist[epoch]
+			s.mu.RUnlock()
+			timer.Stop()
+			return &UpdateProof{Updates: info.updates, Dig: info.dig, Sig: info.sig, UpdSig: info.updSig}, false
+		}
+		ch := s.epochCh
+		s.mu.RUnlock()
+
+		select {
+		case <-ch:
+		case <-timer.C:
+			return &UpdateProof{Updates: make(map[string][]byte)}, true
+		case <-s.closed:
+			timer.Stop()
+			return &UpdateProof{Updates: make(map[string][]byte)}, true
+		}
+	}
 }
 
 type WQReq struct {
@@ -112,10 +265,18 @@ type mapper0Out struct {
 	boundVrfProof  []byte
 	mapVal         []byte
 	pkOpen         *CommitOpen
+	// latestLabel is the uid's latest label, which gets latestVal.
+	latestLabel []byte
+	latestVal   []byte
 }
 
-func (s *Server) Worker() {
-	work := s.workQ.Get()
+// Worker processes a batch of puts.
+// it errors once the work queue is closed and drained.
+func (s *Server) Worker() bool {
+	work, err := s.workQ.Get()
+	if err {
+		return true
+	}
 
 	// error out duplicates.
 	uidSet := make(map[uint64]bool, len(work))
@@ -124,20 +285,19 @@ func (s *Server) Worker() {
 		uid := w.Req.Uid
 		_, ok := uidSet[uid]
 		if ok {
-			w.Resp.Err = true
-			w.Resp.Lat = &Memb{PkOpen: &CommitOpen{}}
-			w.Resp.Bound = &NonMemb{}
+			setErrResp(w.Resp)
 		} else {
 			uidSet[uid] = false
 		}
 	}
 
-	// NOTE: there are no other write lockers outside this fn.
-	// as a result, in this fn, the 3 critical sections view:
+	// NOTE: there are no other writers of keyMap, userInfo, or epochHist
+	// outside this fn, so it reads them without s.mu.
+	// it builds the next epoch on a copy of keyMap, and only takes s.mu
+	// to swap in the new server. as a result, lookups view either:
 	//
 	//  1. current server.
-	//  2. current server to new server.
-	//  3. new server.
+	//  2. new server.
 	//
 	// this is essential to make proper proofs and maintain the server invariant.
 
@@ -165,20 +325,50 @@ func (s *Server) Worker() {
 	}
 	wg.Wait()
 
-	// update server with new entries.
-	s.mu.Lock()
-	upd := make(map[string][]byte, len(work))
+	// make and sign the next epoch.
+	// each put updates a versioned label and the latest label.
+	upd := make(map[string][]byte, 2*len(work))
+	labels := make([][]byte, 0, 2*len(work))
+	vals := make([][]byte, 0, 2*len(work))
 	i = 0
 	for i < uint64(len(work)) {
 		resp := work[i].Resp
 		if !resp.Err {
-			req := work[i].Req
 			out0 := outs0[i]
 			label := out0.latestVrfHash
-
-			err0 := s.keyMap.Put(label, out0.mapVal)
-			std.Assert(!err0)
+			labels = append(labels, label)
+			vals = append(vals, out0.mapVal)
 			upd[string(label)] = out0.mapVal
+			labels = append(labels, out0.latestLabel)
+			vals = append(vals, out0.latestVal)
+			upd[string(out0.latestLabel)] = out0.latestVal
+		}
+		i++
+	}
+	keyMap := s.keyMap.Clone()
+	// labels have the right len, so this only fails on disk errors,
+	// in which case the epoch is dropped.
+	if keyMap.PutBatch(labels, vals) {
+		s.failWork(work)
+		return false
+	}
+	info, err0 := s.signEpoch(keyMap, upd)
+	if err0 {
+		s.failWork(work)
+		return false
+	}
+	// get cosigs before publishing, so that lookups only see cosigned
+	// epochs. this is without s.mu, so an auditor that hangs doesn't
+	// block lookups, which keep seeing the prior epoch.
+	info.cosigs = s.cosignEpoch(uint64(len(s.epochHist)), info)
+
+	// swap in the new server.
+	s.mu.Lock()
+	i = 0
+	for i < uint64(len(work)) {
+		resp := work[i].Resp
+		if !resp.Err {
+			req := work[i].Req
 			var user = s.userInfo[req.Uid]
 			if user == nil {
 				user = &userState{}
@@ -189,7 +379,9 @@ func (s *Server) Worker() {
 		}
 		i++
 	}
-	s.updEpochHist(upd)
+	s.addEpoch(keyMap, info)
+	// AddCosigner might attach cosigs later, so read them under s.mu.
+	dig := getDig(s.epochHist)
 	s.mu.Unlock()
 
 	// map 1.
@@ -201,7 +393,7 @@ func (s *Server) Worker() {
 			out0 := outs0[i]
 			wg1.Add(1)
 			go func() {
-				s.mapper1(out0, resp)
+				s.mapper1(out0, dig, resp)
 				wg1.Done()
 			}()
 		}
@@ -212,6 +404,145 @@ func (s *Server) Worker() {
 	for _, w := range work {
 		w.Finish()
 	}
+	return false
+}
+
+// failWork errors out a batch of puts that didn't make it into an epoch.
+func (s *Server) failWork(work []*Work) {
+	for _, w := range work {
+		setErrResp(w.Resp)
+		w.Finish()
+	}
+}
+
+func setErrResp(resp *WQResp) {
+	resp.Err = true
+	resp.Dig = &SigDig{}
+	resp.Lat = &Memb{PkOpen: &CommitOpen{}}
+	resp.Bound = &NonMemb{}
+}
+
+// AddCosigner has the auditor at cli, with pk, cosign the latest
+// epoch and each new epoch.
+// the server catches up the auditor's log for the server, which must be new.
+// it gets the cosigs on each new epoch before publishing it, waiting up to
+// cosignTimeout, so a failed auditor just leaves out its cosig.
+// the latest epoch is already published, so lookups might briefly
+// miss the new auditor's cosig on it.
+func (s *Server) AddCosigner(cli *advrpc.Client, pk cryptoffi.SigPublicKey) {
+	c := &cosigner{mu: new(sync.Mutex), cli: cli, pk: pk}
+	s.mu.Lock()
+	s.cosigners = append(s.cosigners, c)
+	epoch := uint64(len(s.epochHist)) - 1
+	info := s.epochHist[epoch]
+	s.mu.Unlock()
+	cosig, err := s.cosign(c, epoch, info)
+	if !err {
+		s.addCosigs(epoch, []*Cosig{cosig})
+	}
+}
+
+// cosignEpoch gets each cosigner's sig on epoch, which has info,
+// in parallel, and returns the ones that come in.
+func (s *Server) cosignEpoch(epoch uint64, info *servEpochInfo) []*Cosig {
+	s.mu.RLock()
+	cosigners := s.cosigners
+	s.mu.RUnlock()
+	sigs := make([]*Cosig, len(cosigners))
+	wg := new(sync.WaitGroup)
+	for i, c := range cosigners {
+		wg.Add(1)
+		go func() {
+			cosig, err := s.cosign(c, epoch, info)
+			if !err {
+				sigs[i] = cosig
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	var cosigs []*Cosig
+	for _, cosig := range sigs {
+		if cosig != nil {
+			cosigs = append(cosigs, cosig)
+		}
+	}
+	return cosigs
+}
+
+// addCosigs attaches cosigs to epoch.
+func (s *Server) addCosigs(epoch uint64, cosigs []*Cosig) {
+	if len(cosigs) == 0 {
+		return
+	}
+	s.mu.Lock()
+	info := s.epochHist[epoch]
+	// don't change the cosigs that readers might have.
+	newCosigs := make([]*Cosig, 0, len(info.cosigs)+len(cosigs))
+	newCosigs = append(newCosigs, info.cosigs...)
+	info.cosigs = append(newCosigs, cosigs...)
+	s.mu.Unlock()
+}
+
+// cosign catches up a cosigner through epoch, which has info and
+// might not be published yet, and gets its sig on epoch.
+// it gives up after cosignTimeout, and errors on fail.
+// a later cosign picks up the catch-up where this one left off.
+func (s *Server) cosign(c *cosigner, epoch uint64, info *servEpochInfo) (*Cosig, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cosignTimeout))
+	defer cancel()
+	logId := s.params.SigPk
+	for c.next <= epoch {
+		var next = info
+		if c.next < epoch {
+			next = s.getEpochInfo(c.next)
+		}
+		p := &UpdateProof{Updates: next.updates, Dig: next.dig, Sig: next.sig, UpdSig: next.updSig}
+		if _, err := CallAdtrUpdate(ctx, c.cli, logId, c.next, p); err {
+			return nil, true
+		}
+		c.next++
+	}
+	adtrInfo, err0 := callAdtrGetInner(ctx, c.cli, logId, epoch)
+	if err0 {
+		return nil, true
+	}
+	adtrDig := &SigDig{Epoch: epoch, Dig: info.dig, Sig: adtrInfo.AdtrSig}
+	if CheckAdtrSigDig(logId, adtrDig, c.pk) {
+		return nil, true
+	}
+	return &Cosig{AdtrPk: c.pk, Sig: adtrInfo.AdtrSig}, false
+}
+
+// getEpochInfo returns the info for epoch, which must exist.
+func (s *Server) getEpochInfo(epoch uint64) *servEpochInfo {
+	s.mu.RLock()
+	info := s.epochHist[epoch]
+	s.mu.RUnlock()
+	return info
+}
+
+// Close stops taking puts, finishes the queued ones, ends AuditWaits,
+// and closes the key map. it errors on fail.
+// later Puts and AuditWaits on new epochs error, and a second Close
+// does nothing. the lookups must not be used after.
+func (s *Server) Close() bool {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return false
+	}
+	s.closing = true
+	close(s.closed)
+	s.mu.Unlock()
+	s.workQ.Close()
+	<-s.workerDone
+	s.mu.Lock()
+	err := s.keyMap.Close()
+	s.mu.Unlock()
+	return err
 }
 
 // mapper0 makes mapLabels and mapVals.
@@ -225,9 +556,9 @@ func (s *Server) mapper0(in *WQReq, out *mapper0Out) {
 	boundHash, boundProof := compMapLabel(in.Uid, numVers+1, s.vrfSk)
 
 	nextEpoch := uint64(len(s.epochHist))
-	r := compCommitOpen(s.commitSecret, latHash)
+	r := compCommitOpen(s.suite, s.commitSecret, latHash)
 	open := &CommitOpen{Val: in.Pk, Rand: r}
-	mapVal := compMapVal(nextEpoch, open)
+	mapVal := compMapVal(s.suite, nextEpoch, open)
 
 	out.latestVrfHash = latHash
 	out.latestVrfProof = latProof
@@ -235,20 +566,25 @@ func (s *Server) mapper0(in *WQReq, out *mapper0Out) {
 	out.boundVrfProof = boundProof
 	out.mapVal = mapVal
 	out.pkOpen = open
+
+	latestLabel, _ := compLatestLabel(in.Uid, s.vrfSk)
+	latestR := compLatestRand(s.suite, s.commitSecret, latestLabel, latHash)
+	out.latestLabel = latestLabel
+	out.latestVal = compLatestVal(s.suite, &CommitOpen{Val: in.Pk, Rand: latestR})
 }
 
 // mapper1 computes merkle proofs and assembles full response.
-func (s *Server) mapper1(in *mapper0Out, out *WQResp) {
+func (s *Server) mapper1(in *mapper0Out, dig *SigDig, out *WQResp) {
 	latIn, _, latMerk := s.keyMap.Prove(in.latestVrfHash)
 	std.Assert(latIn)
 
 	boundIn, _, boundMerk := s.keyMap.Prove(in.boundVrfHash)
 	std.Assert(!boundIn)
 
-	out.Dig = getDig(s.epochHist)
+	out.Dig = dig
 	out.Lat = &Memb{
 		LabelProof:  in.latestVrfProof,
-		EpochAdded:  uint64(len(s.epochHist)) - 1,
+		EpochAdded:  dig.Epoch,
 		PkOpen:      in.pkOpen,
 		MerkleProof: latMerk,
 	}
@@ -259,24 +595,59 @@ func (s *Server) mapper1(in *mapper0Out, out *WQResp) {
 }
 
 func NewServer() (*Server, cryptoffi.SigPublicKey, *cryptoffi.VrfPublicKey) {
+	return NewServerSuite(cryptoffi.HashSuiteSha256)
+}
+
+// NewServerSuite makes a server that hashes with suite, which must be valid.
+func NewServerSuite(suite uint64) (*Server, cryptoffi.SigPublicKey, *cryptoffi.VrfPublicKey) {
+	s, sigPk, vrfPk, err := newServer(suite, merkle.NewTreeSuite(suite))
+	std.Assert(!err)
+	return s, sigPk, vrfPk
+}
+
+// NewServerDisk is like NewServerSuite, but it stores the key map in a new
+// file at path, with up to cacheSz nodes cached in memory.
+// it errors if the file can't be created, including if it already exists.
+// Close flushes and closes the file.
+func NewServerDisk(suite uint64, path string, cacheSz uint64) (*Server, cryptoffi.SigPublicKey, *cryptoffi.VrfPublicKey, bool) {
+	keys, err := merkle.NewDiskTree(suite, path, cacheSz)
+	if err {
+		return nil, nil, nil, true
+	}
+	s, sigPk, vrfPk, err1 := newServer(suite, keys)
+	if err1 {
+		keys.Close()
+		return nil, nil, nil, true
+	}
+	return s, sigPk, vrfPk, false
+}
+
+// newServer makes a server with the empty keys. it errors if keys
+// can't snapshot the init epoch.
+func newServer(suite uint64, keys *merkle.Tree) (*Server, cryptoffi.SigPublicKey, *cryptoffi.VrfPublicKey, bool) {
 	mu := new(sync.RWMutex)
 	sigPk, sigSk := cryptoffi.SigGenerateKey()
 	vrfPk, vrfSk := cryptoffi.VrfGenerateKey()
+	params := signParams(sigSk, suite, cryptoffi.VrfPublicKeyEncode(vrfPk), sigPk)
 	sec := cryptoffi.RandBytes(cryptoffi.HashLen)
-	keys := merkle.NewTree()
 	users := make(map[uint64]*userState)
 	var hist []*servEpochInfo
 	// commit empty tree as init epoch.
 	wq := NewWorkQ()
-	s := &Server{mu: mu, sigSk: sigSk, vrfSk: vrfSk, commitSecret: sec, keyMap: keys, userInfo: users, epochHist: hist, workQ: wq}
-	s.updEpochHist(make(map[string][]byte))
+	done := make(chan struct{})
+	s := &Server{mu: mu, sigSk: sigSk, vrfSk: vrfSk, suite: suite, params: params, commitSecret: sec, keyMap: keys, userInfo: users, epochHist: hist, workQ: wq, workerDone: done, epochCh: make(chan struct{}), closed: make(chan struct{})}
+	info, err := s.signEpoch(keys, make(map[string][]byte))
+	if err {
+		return nil, nil, nil, true
+	}
+	s.addEpoch(keys, info)
 
 	go func() {
-		for {
-			s.Worker()
+		for !s.Worker() {
 		}
+		close(done)
 	}()
-	return s, sigPk, vrfPk
+	return s, sigPk, vrfPk, false
 }
 
 // compMapLabel rets the vrf output and proof for mapLabel (VRF(uid || ver)).
@@ -286,40 +657,94 @@ func compMapLabel(uid uint64, ver uint64, sk *cryptoffi.VrfPrivateKey) ([]byte,
 	return sk.Prove(lByt)
 }
 
+// compLatestLabel rets the vrf output and proof for uid's latest label
+// (VRF(uid)).
+func compLatestLabel(uid uint64, sk *cryptoffi.VrfPrivateKey) ([]byte, []byte) {
+	l := &MapLatestLabelPre{Uid: uid}
+	lByt := MapLatestLabelPreEncode(make([]byte, 0, 8), l)
+	return sk.Prove(lByt)
+}
+
+func signParams(sk *cryptoffi.SigPrivateKey, suite uint64, vrfPk, sigPk []byte) *SigParams {
+	pre := &PreSigParams{HashSuite: suite, VrfPk: vrfPk, SigPk: sigPk}
+	preByt := PreSigParamsEncode(make([]byte, 0, 8+8+uint64(len(vrfPk))+8+uint64(len(sigPk))), pre)
+	sig := sk.Sign(preByt)
+	return &SigParams{HashSuite: suite, VrfPk: vrfPk, SigPk: sigPk, Sig: sig}
+}
+
 // compMapVal rets mapVal (epoch || Hash(pk || rand)).
-func compMapVal(epoch uint64, pkOpen *CommitOpen) []byte {
+func compMapVal(suite, epoch uint64, pkOpen *CommitOpen) []byte {
 	openByt := CommitOpenEncode(make([]byte, 0, 8+uint64(len(pkOpen.Val))+8+cryptoffi.HashLen), pkOpen)
-	commit := cryptoutil.Hash(openByt)
+	commit := cryptoutil.HashSuite(suite, openByt)
 	v := &MapValPre{Epoch: epoch, PkCommit: commit}
 	return MapValPreEncode(make([]byte, 0, 8+8+cryptoffi.HashLen), v)
 }
 
-func compCommitOpen(secret, label []byte) []byte {
+// compLatestVal rets the latest label's mapVal (Hash(pk || rand)).
+func compLatestVal(suite uint64, pkOpen *CommitOpen) []byte {
+	openByt := CommitOpenEncode(make([]byte, 0, 8+uint64(len(pkOpen.Val))+8+cryptoffi.HashLen), pkOpen)
+	commit := cryptoutil.HashSuite(suite, openByt)
+	v := &MapLatestValPre{PkCommit: commit}
+	return MapLatestValPreEncode(make([]byte, 0, 8+cryptoffi.HashLen), v)
+}
+
+// compLatestRand rets the latest label's commit rand, for the version
+// with label verLabel. it differs from the version's own rand,
+// so that the two commits can't be linked.
+func compLatestRand(suite uint64, secret, latestLabel, verLabel []byte) []byte {
+	var b = make([]byte, 0, 3*cryptoffi.HashLen)
+	b = append(b, secret...)
+	b = append(b, latestLabel...)
+	b = append(b, verLabel...)
+	return cryptoutil.HashSuite(suite, b)
+}
+
+func compCommitOpen(suite uint64, secret, label []byte) []byte {
 	var b = make([]byte, 0, 2*cryptoffi.HashLen)
 	b = append(b, secret...)
 	b = append(b, label...)
-	return cryptoutil.Hash(b)
+	return cryptoutil.HashSuite(suite, b)
 }
 
-// updEpochHist does a signed history update with some new entries.
-func (s *Server) updEpochHist(upd map[string][]byte) {
+// signEpoch snapshots keyMap, which has upd on top of s.keyMap,
+// as the next epoch, and signs it. it errors if the snapshot fails.
+func (s *Server) signEpoch(keyMap *merkle.Tree, upd map[string][]byte) (*servEpochInfo, bool) {
 	sk := s.sigSk
-	dig := s.keyMap.Digest()
+	dig := keyMap.Digest()
 	epoch := uint64(len(s.epochHist))
+	// keep keyMap snapshots aligned with epochs.
+	snap, err := keyMap.Snapshot()
+	if err {
+		return nil, true
+	}
+	std.Assert(snap == epoch)
+	if epoch >= keptSnaps {
+		keyMap.Prune(epoch + 1 - keptSnaps)
+	}
 	preSig := &PreSigDig{Epoch: epoch, Dig: dig}
 	preSigByt := PreSigDigEncode(make([]byte, 0, 8+8+cryptoffi.HashLen), preSig)
 	sig := sk.Sign(preSigByt)
+	updSig := sk.Sign(preSigUpd(epoch, dig, upd))
 	// benchmark: turn off sigs for akd compat.
 	// _ = sk
 	// var sig []byte
-	newInfo := &servEpochInfo{updates: upd, dig: dig, sig: sig}
-	s.epochHist = append(s.epochHist, newInfo)
+	return &servEpochInfo{updates: upd, dig: dig, sig: sig, updSig: updSig}, false
+}
+
+// addEpoch publishes keyMap, with its signed info, as the next epoch.
+// it requires s.mu, outside of server init.
+func (s *Server) addEpoch(keyMap *merkle.Tree, info *servEpochInfo) {
+	s.keyMap = keyMap
+	s.epochHist = append(s.epochHist, info)
+	// wake up AuditWait.
+	close(s.epochCh)
+	s.epochCh = make(chan struct{})
 }
 
 func getDig(hist []*servEpochInfo) *SigDig {
 	numEpochs := uint64(len(hist))
 	lastInfo := hist[numEpochs-1]
-	return &SigDig{Epoch: numEpochs - 1, Dig: lastInfo.dig, Sig: lastInfo.sig}
+	return &SigDig{Epoch: numEpochs - 1, Dig: lastInfo.dig, Sig: lastInfo.sig, Cosigs: lastInfo.cosigs}
 }
 
 // getHist returns membership proofs for the history of versions
@@ -343,7 +768,7 @@ func getHist(keyMap *merkle.Tree, uid, numVers uint64, vrfSk *cryptoffi.VrfPriva
 
 // getLatest returns whether a version is registered, and if so,
 // a membership proof for the latest version.
-func getLatest(keyMap *merkle.Tree, uid, numVers uint64, vrfSk *cryptoffi.VrfPrivateKey, commitSecret, pk []byte) (bool, *Memb) {
+func getLatest(keyMap *merkle.Tree, suite, uid, numVers uint64, vrfSk *cryptoffi.VrfPrivateKey, commitSecret, pk []byte) (bool, *Memb) {
 	if numVers == 0 {
 		return false, &Memb{PkOpen: &CommitOpen{}}
 	}
@@ -352,11 +777,27 @@ func getLatest(keyMap *merkle.Tree, uid, numVers uint64, vrfSk *cryptoffi.VrfPri
 	std.Assert(inMap)
 	valPre, _, err1 := MapValPreDecode(mapVal)
 	std.Assert(!err1)
-	r := compCommitOpen(commitSecret, label)
+	r := compCommitOpen(suite, commitSecret, label)
 	open := &CommitOpen{Val: pk, Rand: r}
 	return true, &Memb{LabelProof: labelProof, EpochAdded: valPre.Epoch, PkOpen: open, MerkleProof: mapProof}
 }
 
+// getLatestLabel returns a proof for uid's latest label, which is in the
+// map, committing to pk, iff a version is registered.
+func getLatestLabel(keyMap *merkle.Tree, suite, uid, numVers uint64, vrfSk *cryptoffi.VrfPrivateKey, commitSecret, pk []byte) *LatestProof {
+	label, labelProof := compLatestLabel(uid, vrfSk)
+	inMap, _, mapProof := keyMap.Prove(label)
+	if numVers == 0 {
+		std.Assert(!inMap)
+		return &LatestProof{LabelProof: labelProof, PkOpen: &CommitOpen{}, MerkleProof: mapProof}
+	}
+	std.Assert(inMap)
+	verLabel, _ := compMapLabel(uid, numVers-1, vrfSk)
+	r := compLatestRand(suite, commitSecret, label, verLabel)
+	open := &CommitOpen{Val: pk, Rand: r}
+	return &LatestProof{LabelProof: labelProof, PkOpen: open, MerkleProof: mapProof}
+}
+
 // getBound returns a non-membership proof for the boundary version.
 func getBound(keyMap *merkle.Tree, uid, numVers uint64, vrfSk *cryptoffi.VrfPrivateKey) *NonMemb {
 	label, labelProof := compMapLabel(uid, numVers, vrfSk)
@@ -0,0 +1,140 @@
+package kt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mit-pdos/pav/cryptoffi"
+)
+
+func TestServClose(t *testing.T) {
+	serv, _, _ := NewServer()
+
+	// a blocked AuditWait returns once the server closes.
+	waitErr := make(chan bool, 1)
+	go func() {
+		_, err := serv.AuditWait(1_000)
+		waitErr <- err
+	}()
+
+	// queued puts either finish or fail cleanly.
+	nPuts := 20
+	var wg sync.WaitGroup
+	for i := 0; i < nPuts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dig, latest, bound, err := serv.Put(uint64(i), []byte{byte(i)})
+			if dig == nil || latest == nil || bound == nil {
+				t.Error()
+			}
+			if !err && dig.Epoch == 0 {
+				t.Error()
+			}
+		}()
+	}
+	if serv.Close() {
+		t.Fatal()
+	}
+	wg.Wait()
+	select {
+	case err := <-waitErr:
+		if !err {
+			t.Fatal()
+		}
+	case <-time.After(time.Duration(auditWaitTimeout) / 2):
+		t.Fatal()
+	}
+
+	// calls after Close error, and a second Close does nothing.
+	if _, _, _, err := serv.Put(uint64(nPuts), []byte{0}); !err {
+		t.Fatal()
+	}
+	if _, err := serv.AuditWait(1_000); !err {
+		t.Fatal()
+	}
+	if serv.Close() {
+		t.Fatal()
+	}
+}
+
+func TestAdtrClose(t *testing.T) {
+	serv, servSigPk, _ := NewServer()
+	defer serv.Close()
+	if _, _, _, err := serv.Put(0, []byte{0}); err {
+		t.Fatal()
+	}
+	aud, _ := NewAuditor(servSigPk)
+	p0, _ := serv.Audit(0)
+	if _, err := aud.Update(servSigPk, p0); err {
+		t.Fatal()
+	}
+	if aud.Close() {
+		t.Fatal()
+	}
+
+	p1, _ := serv.Audit(1)
+	if _, err := aud.Update(servSigPk, p1); !err {
+		t.Fatal()
+	}
+	if _, err := aud.Get(servSigPk, 0); !err {
+		t.Fatal()
+	}
+	if !aud.AddLog(cryptoffi.HashSuiteSha256, []byte{0}) {
+		t.Fatal()
+	}
+	if aud.Close() {
+		t.Fatal()
+	}
+}
+
+func TestServSnaps(t *testing.T) {
+	serv, _, _ := NewServer()
+	defer serv.Close()
+	for uid := uint64(0); uid < keptSnaps+2; uid++ {
+		if _, _, _, err := serv.Put(uid, []byte{1}); err {
+			t.Fatal()
+		}
+	}
+	// only the recent snapshots are kept.
+	dig, _, _ := serv.SelfMon(0)
+	if _, err := serv.keyMap.DigestAt(dig.Epoch - keptSnaps); !err {
+		t.Fatal()
+	}
+	old, err0 := serv.keyMap.DigestAt(dig.Epoch + 1 - keptSnaps)
+	if err0 || !bytes.Equal(old, serv.epochHist[dig.Epoch+1-keptSnaps].dig) {
+		t.Fatal()
+	}
+}
+
+func TestServDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	serv, _, _, err0 := NewServerDisk(cryptoffi.HashSuiteSha256, path, 1_000)
+	if err0 {
+		t.Fatal()
+	}
+	// an existing key map doesn't get truncated.
+	if _, _, _, err := NewServerDisk(cryptoffi.HashSuiteSha256, path, 1_000); !err {
+		t.Fatal()
+	}
+	for uid := uint64(0); uid < 3; uid++ {
+		if _, _, _, err := serv.Put(uid, []byte{1}); err {
+			t.Fatal()
+		}
+	}
+	dig, _, isReg, latest, _ := serv.Get(1)
+	if !isReg || !bytes.Equal(latest.PkOpen.Val, []byte{1}) || latest.EpochAdded > dig.Epoch {
+		t.Fatal()
+	}
+	if serv.Close() {
+		t.Fatal()
+	}
+	info, err1 := os.Stat(path)
+	if err1 != nil || info.Size() == 0 {
+		t.Fatal()
+	}
+}
@@ -16,6 +16,8 @@ type WorkQ struct {
 	mu   *sync.Mutex
 	work []*Work
 	cond *sync.Cond
+	// closed stops new work, while queued work still gets done.
+	closed bool
 }
 
 func NewWork(req *WQReq) *Work {
@@ -31,9 +33,14 @@ func (w *Work) Finish() {
 	w.mu.Unlock()
 }
 
+// Do returns an error resp if the queue is closed.
 func (wq *WorkQ) Do(req *WQReq) *WQResp {
 	w := NewWork(req)
 	wq.mu.Lock()
+	if wq.closed {
+		wq.mu.Unlock()
+		return &WQResp{Dig: &SigDig{}, Lat: &Memb{PkOpen: &CommitOpen{}}, Bound: &NonMemb{}, Err: true}
+	}
 	wq.work = append(wq.work, w)
 	wq.cond.Signal()
 	wq.mu.Unlock()
@@ -56,6 +63,7 @@ func (wq *WorkQ) DoBatch(reqs []*WQReq) {
 	}
 
 	wq.mu.Lock()
+	// benchmarks don't race with Close.
 	wq.work = append(wq.work, works...)
 	wq.cond.Signal()
 	wq.mu.Unlock()
@@ -72,16 +80,31 @@ func (wq *WorkQ) DoBatch(reqs []*WQReq) {
 	}
 }
 
-func (wq *WorkQ) Get() []*Work {
+// Get returns the next batch of work.
+// it errors once the queue is closed and drained.
+func (wq *WorkQ) Get() ([]*Work, bool) {
 	wq.mu.Lock()
-	for wq.work == nil {
+	for wq.work == nil && !wq.closed {
 		wq.cond.Wait()
 	}
+	if wq.work == nil {
+		wq.mu.Unlock()
+		return nil, true
+	}
 
 	work := wq.work
 	wq.work = nil
 	wq.mu.Unlock()
-	return work
+	return work, false
+}
+
+// Close stops the queue from taking new work.
+// Get still returns the already-queued work.
+func (wq *WorkQ) Close() {
+	wq.mu.Lock()
+	wq.closed = true
+	wq.cond.Broadcast()
+	wq.mu.Unlock()
 }
 
 func NewWorkQ() *WorkQ {
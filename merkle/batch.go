@@ -0,0 +1,134 @@
+package merkle
+
+import (
+	"math/bits"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/goose-lang/std"
+	"github.com/mit-pdos/pav/cryptoffi"
+)
+
+const (
+	// parBatchSz is the min number of entries for which putBatch
+	// builds the two child subtrees in parallel.
+	parBatchSz int = 256
+)
+
+type entry struct {
+	label []byte
+	val   []byte
+}
+
+// PutBatch is unverified. it has the same effect as calling Put on
+// each (labels[i], vals[i]) in order, but it rehashes shared ancestors
+// once and builds disjoint subtrees in parallel.
+// it errors without changing the tree if any label has the wrong length
+// or if labels and vals have different lengths, or, for disk-backed trees,
+// on a failed disk read or write.
+func (t *Tree) PutBatch(labels, vals [][]byte) bool {
+	if len(labels) != len(vals) {
+		return true
+	}
+	ents := make([]*entry, 0, len(labels))
+	for i, label := range labels {
+		if uint64(len(label)) != cryptoffi.HashLen {
+			return true
+		}
+		ents = append(ents, &entry{label: label, val: vals[i]})
+	}
+	slices.SortStableFunc(ents, func(e0, e1 *entry) int {
+		return cmpLabels(e0.label, e1.label)
+	})
+	// dedup, keeping the last put of each label.
+	uniq := make([]*entry, 0, len(ents))
+	for i, e := range ents {
+		if i+1 < len(ents) && std.BytesEqual(e.label, ents[i+1].label) {
+			continue
+		}
+		uniq = append(uniq, e)
+	}
+
+	root, err := putBatch(t.root, 0, uniq, t.ctx)
+	if err {
+		return true
+	}
+	st := t.ctx.store
+	if st != nil && st.pending+uint64(len(uniq)) >= maxPending {
+		stub, err1 := st.flush(root)
+		if err1 {
+			return true
+		}
+		root = stub
+	} else if st != nil {
+		st.pending += uint64(len(uniq))
+	}
+	t.root = root
+	return false
+}
+
+// putBatch returns the new root of the subtree n after adding ents,
+// which must be unique and sorted by cmpLabels.
+// it errors if a disk read fails.
+func putBatch(n0 *node, depth uint64, ents []*entry, ctx *context) (*node, bool) {
+	if len(ents) == 0 {
+		return n0, false
+	}
+	if len(ents) == 1 {
+		return put(n0, depth, ents[0].label, ents[0].val, ctx)
+	}
+
+	// multiple labels end up below n, so it must become an inner node.
+	n, err := ctx.load(n0)
+	if err {
+		return nil, true
+	}
+	inner := &node{}
+	if n != nil {
+		if n.child0 == nil && n.child1 == nil {
+			leafChild, _ := getChild(inner, n.label, depth)
+			*leafChild = n
+		} else {
+			inner.child0 = n.child0
+			inner.child1 = n.child1
+		}
+	}
+
+	// sorting puts the entries that go to child1 in a suffix.
+	split := sort.Search(len(ents), func(i int) bool {
+		return getBit(ents[i].label, depth)
+	})
+	var err0 bool
+	var err1 bool
+	if len(ents) < parBatchSz {
+		inner.child0, err0 = putBatch(inner.child0, depth+1, ents[:split], ctx)
+		inner.child1, err1 = putBatch(inner.child1, depth+1, ents[split:], ctx)
+	} else {
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		go func() {
+			inner.child0, err0 = putBatch(inner.child0, depth+1, ents[:split], ctx)
+			wg.Done()
+		}()
+		inner.child1, err1 = putBatch(inner.child1, depth+1, ents[split:], ctx)
+		wg.Wait()
+	}
+	if err0 || err1 {
+		return nil, true
+	}
+	setInnerHash(inner, ctx)
+	return inner, false
+}
+
+// cmpLabels orders labels by their tree path, i.e., by getBit order.
+func cmpLabels(l0, l1 []byte) int {
+	n := min(len(l0), len(l1))
+	for i := 0; i < n; i++ {
+		if l0[i] != l1[i] {
+			// getBit reads bits from least to most significant.
+			return int(bits.Reverse8(l0[i])) - int(bits.Reverse8(l1[i]))
+		}
+	}
+	return len(l0) - len(l1)
+}
@@ -37,6 +37,34 @@ func TestBenchMerkPut(t *testing.T) {
 	})
 }
 
+func TestBenchMerkPutBatch(t *testing.T) {
+	tr, _ := seedTree(t, defNSeed)
+	nOps := 500_000
+	batchSz := 1_000
+
+	start := time.Now()
+	for i := 0; i < nOps; i += batchSz {
+		labels := make([][]byte, 0, batchSz)
+		vals := make([][]byte, 0, batchSz)
+		for j := 0; j < batchSz; j++ {
+			labels = append(labels, mkRandLabel())
+			vals = append(vals, mkRandVal())
+		}
+		errb := tr.PutBatch(labels, vals)
+		if errb {
+			t.Fatal()
+		}
+	}
+	total := time.Since(start)
+
+	m0 := float64(total.Microseconds()) / float64(nOps)
+	m1 := float64(total.Milliseconds())
+	benchutil.Report(nOps, []*benchutil.Metric{
+		{N: m0, Unit: "us/op"},
+		{N: m1, Unit: "total(ms)"},
+	})
+}
+
 func TestBenchMerkGet(t *testing.T) {
 	tr, labels := seedTree(t, defNSeed)
 	nOps := 5_000_000
@@ -14,15 +14,25 @@ const (
 	innerNodeTag byte = 2
 )
 
+// Tree is a persistent merkle tree.
+// Put never mutates existing nodes, instead copying the nodes along
+// the updated path, so prior roots remain valid and can be snapshotted.
 type Tree struct {
 	ctx  *context
 	root *node
+	// snaps stores the root of every snapshotted epoch from base on.
+	snaps []*node
+	// base is the first epoch in snaps. Prune drops the ones before it.
+	base uint64
 }
 
 // node contains the union of different node types, which distinguish as:
 //  1. empty node. if node ptr is nil.
 //  2. leaf node. if child0 and child1 nil. has hash, label, and val.
 //  3. inner node. else. has hash.
+//
+// disk-backed trees additionally have stub nodes, which only have
+// hash and off, and must be loaded before being inspected.
 type node struct {
 	hash []byte
 	// only for inner node.
@@ -33,62 +43,153 @@ type node struct {
 	label []byte
 	// only for leaf node.
 	val []byte
+	// off is the node's store offset, or 0 if only in memory.
+	off uint64
 }
 
 type context struct {
+	// suite is the cryptoffi hash suite.
+	suite     uint64
 	emptyHash []byte
+	// store is nil for in-memory trees.
+	store *store
+}
+
+// load returns the full node for a possible stub.
+// it errors if a disk read fails.
+func (c *context) load(n *node) (*node, bool) {
+	if n == nil || n.off == 0 {
+		return n, false
+	}
+	return c.store.get(n.off)
 }
 
 // Put adds (label, val) to the tree, storing immutable references to both.
 // for liveness (not safety) reasons, it returns an error
 // if the label does not have a fixed length.
+// for disk-backed trees, it also errors on a failed disk read or write.
+// on error, the tree is unchanged.
 func (t *Tree) Put(label []byte, val []byte) bool {
 	if uint64(len(label)) != cryptoffi.HashLen {
 		return true
 	}
-	put(&t.root, 0, label, val, t.ctx)
+	root, err := put(t.root, 0, label, val, t.ctx)
+	if err {
+		return true
+	}
+	st := t.ctx.store
+	if st != nil && st.pending+1 >= maxPending {
+		stub, err1 := st.flush(root)
+		if err1 {
+			return true
+		}
+		root = stub
+	} else if st != nil {
+		st.pending++
+	}
+	t.root = root
 	return false
 }
 
-func put(n0 **node, depth uint64, label, val []byte, ctx *context) {
-	n := *n0
+// put returns the new root of the subtree n after adding (label, val).
+// it copies every node on the label path and leaves n unchanged.
+// it errors if a disk read fails.
+func put(n0 *node, depth uint64, label, val []byte, ctx *context) (*node, bool) {
+	n, err0 := ctx.load(n0)
+	if err0 {
+		return nil, true
+	}
 	// empty node.
 	if n == nil {
 		// replace with leaf node.
 		leaf := &node{label: label, val: val}
-		*n0 = leaf
-		setLeafHash(leaf)
-		return
+		setLeafHash(leaf, ctx)
+		return leaf, false
 	}
 
 	// leaf node.
 	if n.child0 == nil && n.child1 == nil {
 		// on exact label match, replace val.
 		if std.BytesEqual(n.label, label) {
-			n.val = val
-			setLeafHash(n)
-			return
+			leaf := &node{label: label, val: val}
+			setLeafHash(leaf, ctx)
+			return leaf, false
 		}
 
 		// otherwise, replace with inner node that links
 		// to existing leaf, and recurse.
 		inner := &node{}
-		*n0 = inner
 		leafChild, _ := getChild(inner, n.label, depth)
 		*leafChild = n
 		recurChild, _ := getChild(inner, label, depth)
-		put(recurChild, depth+1, label, val, ctx)
+		child, err1 := put(*recurChild, depth+1, label, val, ctx)
+		if err1 {
+			return nil, true
+		}
+		*recurChild = child
 		setInnerHash(inner, ctx)
+		return inner, false
+	}
+
+	// inner node. copy and recurse.
+	inner := &node{child0: n.child0, child1: n.child1}
+	c, _ := getChild(inner, label, depth)
+	child, err2 := put(*c, depth+1, label, val, ctx)
+	if err2 {
+		return nil, true
+	}
+	*c = child
+	setInnerHash(inner, ctx)
+	return inner, false
+}
+
+// Snapshot freezes the current tree as the next epoch and returns
+// that epoch. later Puts don't affect the snapshot.
+// for disk-backed trees, it errors, without snapshotting,
+// if the disk write fails.
+func (t *Tree) Snapshot() (uint64, bool) {
+	st := t.ctx.store
+	if st != nil {
+		stub, err := st.flush(t.root)
+		if err {
+			return 0, true
+		}
+		t.root = stub
+	}
+	epoch := t.base + uint64(len(t.snaps))
+	t.snaps = append(t.snaps, t.root)
+	return epoch, false
+}
+
+// Prune drops the snapshots of the epochs before epoch, so that
+// nodes only they reference can be freed. later epochs keep their numbers,
+// and pruning past the last snapshot drops all of them.
+// disk-backed trees keep the pruned nodes on disk.
+func (t *Tree) Prune(epoch uint64) {
+	if epoch <= t.base {
 		return
 	}
+	var n = uint64(len(t.snaps))
+	if epoch-t.base < n {
+		n = epoch - t.base
+	}
+	// copy, so that the old array doesn't keep the pruned roots alive.
+	t.snaps = append([]*node(nil), t.snaps[n:]...)
+	t.base += n
+}
 
-	// inner node. recurse.
-	c, _ := getChild(n, label, depth)
-	put(c, depth+1, label, val, ctx)
-	setInnerHash(n, ctx)
+// Clone is unverified. it returns a copy of t, including snapshots,
+// in constant time, since nodes are immutable.
+// later changes to either tree don't affect the other.
+// disk-backed copies share a store, so only one of them may be closed.
+func (t *Tree) Clone() *Tree {
+	// capping the snaps cap makes the copy's appends realloc.
+	n := len(t.snaps)
+	return &Tree{ctx: t.ctx, root: t.root, snaps: t.snaps[:n:n], base: t.base}
 }
 
 // Get returns if label is in the tree and if so, the val.
+// like Prove, it panics on a failed disk read.
 func (t *Tree) Get(label []byte) (bool, []byte) {
 	in, val, _ := t.prove(label, false)
 	return in, val
@@ -96,12 +197,36 @@ func (t *Tree) Get(label []byte) (bool, []byte) {
 
 // Prove returns if label is in tree (and if so, the val) and
 // a cryptographic proof of this.
+// it has no error return, so a failed disk read panics.
+// use ProveAt to get the error instead.
 func (t *Tree) Prove(label []byte) (bool, []byte, []byte) {
 	return t.prove(label, true)
 }
 
+// ProveAt is like Prove, but against the tree snapshotted at epoch.
+// it errors if epoch hasn't been snapshotted, or was pruned,
+// or if a disk read fails.
+func (t *Tree) ProveAt(epoch uint64, label []byte) (bool, []byte, []byte, bool) {
+	if epoch < t.base || epoch-t.base >= uint64(len(t.snaps)) {
+		return false, nil, nil, true
+	}
+	return prove(t.snaps[epoch-t.base], label, true, t.ctx)
+}
+
 func (t *Tree) prove(label []byte, getProof bool) (bool, []byte, []byte) {
-	found, foundLabel, foundVal, proof0 := find(label, getProof, t.ctx, t.root, 0)
+	in, val, proof, err := prove(t.root, label, getProof, t.ctx)
+	if err {
+		panic("merkle: store read err")
+	}
+	return in, val, proof
+}
+
+// prove errors if a disk read fails.
+func prove(root *node, label []byte, getProof bool, ctx *context) (bool, []byte, []byte, bool) {
+	found, foundLabel, foundVal, proof0, err := find(label, getProof, ctx, root, 0)
+	if err {
+		return false, nil, nil, true
+	}
 	var proof = proof0
 	if getProof {
 		primitive.UInt64Put(proof, uint64(len(proof))-8) // SibsLen
@@ -113,7 +238,7 @@ func (t *Tree) prove(label []byte, getProof bool) (bool, []byte, []byte) {
 			proof = marshal.WriteInt(proof, 0)      // empty LeafLabelLen
 			proof = marshal.WriteInt(proof, 0)      // empty LeafValLen
 		}
-		return false, nil, proof
+		return false, nil, proof, false
 	}
 	if !std.BytesEqual(foundLabel, label) {
 		if getProof {
@@ -123,26 +248,30 @@ func (t *Tree) prove(label []byte, getProof bool) (bool, []byte, []byte) {
 			proof = marshal.WriteInt(proof, uint64(len(foundVal)))
 			proof = marshal.WriteBytes(proof, foundVal)
 		}
-		return false, nil, proof
+		return false, nil, proof, false
 	}
 	if getProof {
 		proof = marshal.WriteBool(proof, false) // FoundOtherLeaf
 		proof = marshal.WriteInt(proof, 0)      // empty LeafLabelLen
 		proof = marshal.WriteInt(proof, 0)      // empty LeafValLen
 	}
-	return true, foundVal, proof
+	return true, foundVal, proof, false
 }
 
 // find returns whether label path was found (and if so, the found label and val)
-// and the sibling proof.
-func find(label []byte, getProof bool, ctx *context, n *node, depth uint64) (bool, []byte, []byte, []byte) {
+// and the sibling proof. it errors if a disk read fails.
+func find(label []byte, getProof bool, ctx *context, n0 *node, depth uint64) (bool, []byte, []byte, []byte, bool) {
+	n, err0 := ctx.load(n0)
+	if err0 {
+		return false, nil, nil, nil, true
+	}
 	// break on empty node.
 	if n == nil {
 		var proof []byte
 		if getProof {
 			proof = make([]byte, 8, getProofLen(depth))
 		}
-		return false, nil, nil, proof
+		return false, nil, nil, proof, false
 	}
 	// break on leaf node.
 	if n.child0 == nil && n.child1 == nil {
@@ -150,17 +279,20 @@ func find(label []byte, getProof bool, ctx *context, n *node, depth uint64) (boo
 		if getProof {
 			proof = make([]byte, 8, getProofLen(depth))
 		}
-		return true, n.label, n.val, proof
+		return true, n.label, n.val, proof, false
 	}
 
 	child, sib := getChild(n, label, depth)
-	f, fl, fv, proof0 := find(label, getProof, ctx, *child, depth+1)
+	f, fl, fv, proof0, err1 := find(label, getProof, ctx, *child, depth+1)
+	if err1 {
+		return false, nil, nil, nil, true
+	}
 	var proof = proof0
 	if getProof {
 		// proof will have sibling hash for each inner node.
 		proof = append(proof, getNodeHash(sib, ctx)...)
 	}
-	return f, fl, fv, proof
+	return f, fl, fv, proof, false
 }
 
 func getProofLen(depth uint64) uint64 {
@@ -175,6 +307,11 @@ func getProofLen(depth uint64) uint64 {
 // if inTree, (label, val) should be in the tree.
 // if !inTree, label should not be in the tree.
 func Verify(inTree bool, label, val, proof, dig []byte) bool {
+	return VerifySuite(cryptoffi.HashSuiteSha256, inTree, label, val, proof, dig)
+}
+
+// VerifySuite is like Verify, but for a tree with a particular hash suite.
+func VerifySuite(suite uint64, inTree bool, label, val, proof, dig []byte) bool {
 	proofDec, _, err0 := MerkleProofDecode(proof)
 	if err0 {
 		return true
@@ -184,24 +321,24 @@ func Verify(inTree bool, label, val, proof, dig []byte) bool {
 	var lastHash []byte
 	var err1 bool
 	if inTree {
-		lastHash = compLeafHash(label, val)
+		lastHash = compLeafHash(suite, label, val)
 	} else {
 		if proofDec.FoundOtherLeaf {
-			lastHash = compLeafHash(proofDec.LeafLabel, proofDec.LeafVal)
+			lastHash = compLeafHash(suite, proofDec.LeafLabel, proofDec.LeafVal)
 			if std.BytesEqual(label, proofDec.LeafLabel) {
 				err1 = true
 			}
 		} else {
-			lastHash = compEmptyHash()
+			lastHash = compEmptyHash(suite)
 		}
 	}
 	if err1 {
 		return true
 	}
-	return verifySiblings(label, lastHash, proofDec.Siblings, dig)
+	return verifySiblings(suite, label, lastHash, proofDec.Siblings, dig)
 }
 
-func verifySiblings(label, lastHash, siblings, dig []byte) bool {
+func verifySiblings(suite uint64, label, lastHash, siblings, dig []byte) bool {
 	sibsLen := uint64(len(siblings))
 	if sibsLen%cryptoffi.HashLen != 0 {
 		return true
@@ -219,9 +356,9 @@ func verifySiblings(label, lastHash, siblings, dig []byte) bool {
 
 		depth := maxDepth - depthInv - 1
 		if !getBit(label, depth) {
-			hashOut = compInnerHash(currHash, sib, hashOut)
+			hashOut = compInnerHash(suite, currHash, sib, hashOut)
 		} else {
-			hashOut = compInnerHash(sib, currHash, hashOut)
+			hashOut = compInnerHash(suite, sib, currHash, hashOut)
 		}
 		currHash = append(currHash[:0], hashOut...)
 		hashOut = hashOut[:0]
@@ -235,11 +372,56 @@ func (t *Tree) Digest() []byte {
 	return getNodeHash(t.root, t.ctx)
 }
 
+// DigestAt returns the digest of the tree snapshotted at epoch.
+// it errors if epoch hasn't been snapshotted, or was pruned.
+func (t *Tree) DigestAt(epoch uint64) ([]byte, bool) {
+	if epoch < t.base || epoch-t.base >= uint64(len(t.snaps)) {
+		return nil, true
+	}
+	return getNodeHash(t.snaps[epoch-t.base], t.ctx), false
+}
+
 func NewTree() *Tree {
-	c := &context{emptyHash: compEmptyHash()}
+	return NewTreeSuite(cryptoffi.HashSuiteSha256)
+}
+
+// NewTreeSuite returns a tree that hashes with suite, which must be valid.
+func NewTreeSuite(suite uint64) *Tree {
+	c := &context{suite: suite, emptyHash: compEmptyHash(suite)}
 	return &Tree{ctx: c}
 }
 
+// NewDiskTree returns a tree that hashes with suite and stores its nodes
+// in a new file at path, keeping up to cacheSz recently-used nodes in memory.
+// it errors if the file can't be created, including if it already exists,
+// since trees can't be reopened.
+// unlike in-memory trees, Snapshot and Put may block on disk writes.
+func NewDiskTree(suite uint64, path string, cacheSz uint64) (*Tree, bool) {
+	st, err := newStore(path, cacheSz)
+	if err {
+		return nil, true
+	}
+	c := &context{suite: suite, emptyHash: compEmptyHash(suite), store: st}
+	return &Tree{ctx: c}, false
+}
+
+// Close flushes and closes a disk-backed tree, after which
+// it must not be used. it errors on fail.
+// for in-memory trees, it's a no-op.
+func (t *Tree) Close() bool {
+	st := t.ctx.store
+	if st == nil {
+		return false
+	}
+	stub, err := st.flush(t.root)
+	if err {
+		st.close()
+		return true
+	}
+	t.root = stub
+	return st.close()
+}
+
 func getNodeHash(n *node, c *context) []byte {
 	if n == nil {
 		return c.emptyHash
@@ -247,16 +429,16 @@ func getNodeHash(n *node, c *context) []byte {
 	return n.hash
 }
 
-func compEmptyHash() []byte {
-	return cryptoutil.Hash([]byte{emptyNodeTag})
+func compEmptyHash(suite uint64) []byte {
+	return cryptoutil.HashSuite(suite, []byte{emptyNodeTag})
 }
 
-func setLeafHash(n *node) {
-	n.hash = compLeafHash(n.label, n.val)
+func setLeafHash(n *node, c *context) {
+	n.hash = compLeafHash(c.suite, n.label, n.val)
 }
 
-func compLeafHash(label, val []byte) []byte {
-	hr := cryptoffi.NewHasher()
+func compLeafHash(suite uint64, label, val []byte) []byte {
+	hr := cryptoffi.NewHasherSuite(suite)
 	hr.Write([]byte{leafNodeTag})
 	hr.Write(marshal.WriteInt(nil, uint64(len(label))))
 	hr.Write(label)
@@ -268,11 +450,11 @@ func compLeafHash(label, val []byte) []byte {
 func setInnerHash(n *node, c *context) {
 	child0 := getNodeHash(n.child0, c)
 	child1 := getNodeHash(n.child1, c)
-	n.hash = compInnerHash(child0, child1, nil)
+	n.hash = compInnerHash(c.suite, child0, child1, nil)
 }
 
-func compInnerHash(child0, child1, h []byte) []byte {
-	hr := cryptoffi.NewHasher()
+func compInnerHash(suite uint64, child0, child1, h []byte) []byte {
+	hr := cryptoffi.NewHasherSuite(suite)
 	hr.Write([]byte{innerNodeTag})
 	hr.Write(child0)
 	hr.Write(child1)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"github.com/mit-pdos/pav/cryptoffi"
 	"math/rand/v2"
+	"path/filepath"
 	"testing"
 )
 
@@ -75,6 +76,384 @@ func TestMap(t *testing.T) {
 	}
 }
 
+func TestProveAt(t *testing.T) {
+	tr := NewTree()
+	var seed [32]byte
+	rnd := rand.NewChaCha8(seed)
+	label := make([]byte, cryptoffi.HashLen)
+	val := make([]byte, 4)
+	var labels [][]byte
+	var vals [][]byte
+
+	// epoch i has labels[:i], each with its val from that epoch.
+	for i := 0; i < 100; i++ {
+		if epoch, errb := tr.Snapshot(); errb || epoch != uint64(i) {
+			t.Fatal()
+		}
+		_, err := rnd.Read(label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rnd.Read(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels = append(labels, bytes.Clone(label))
+		vals = append(vals, bytes.Clone(val))
+		if tr.Put(bytes.Clone(label), bytes.Clone(val)) {
+			t.Fatal()
+		}
+	}
+
+	// overwrite every val, which shouldn't change old snapshots.
+	for _, l := range labels {
+		if tr.Put(l, []byte{0}) {
+			t.Fatal()
+		}
+	}
+	last, errb0 := tr.Snapshot()
+	if errb0 {
+		t.Fatal()
+	}
+
+	for epoch := uint64(0); epoch < last; epoch++ {
+		dig, errb := tr.DigestAt(epoch)
+		if errb {
+			t.Fatal()
+		}
+		for i, l := range labels {
+			inTree, v, proof, errb := tr.ProveAt(epoch, l)
+			if errb {
+				t.Fatal()
+			}
+			expIn := uint64(i) < epoch
+			if inTree != expIn {
+				t.Fatal()
+			}
+			if expIn && !bytes.Equal(v, vals[i]) {
+				t.Fatal()
+			}
+			if Verify(inTree, l, v, proof, dig) {
+				t.Fatal()
+			}
+		}
+	}
+
+	// latest snapshot matches the live tree.
+	dig, errb := tr.DigestAt(last)
+	if errb || !bytes.Equal(dig, tr.Digest()) {
+		t.Fatal()
+	}
+	if _, errb = tr.DigestAt(last + 1); !errb {
+		t.Fatal()
+	}
+	if _, _, _, errb = tr.ProveAt(last+1, labels[0]); !errb {
+		t.Fatal()
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tr := NewTree()
+	label := make([]byte, cryptoffi.HashLen)
+	var digs [][]byte
+	for i := byte(0); i < 5; i++ {
+		label[0] = i
+		if tr.Put(bytes.Clone(label), []byte{i}) {
+			t.Fatal()
+		}
+		if _, errb := tr.Snapshot(); errb {
+			t.Fatal()
+		}
+		digs = append(digs, tr.Digest())
+	}
+
+	// pruned epochs are gone, and later ones keep their numbers.
+	tr.Prune(3)
+	tr.Prune(1)
+	if _, errb := tr.DigestAt(2); !errb {
+		t.Fatal()
+	}
+	if _, _, _, errb := tr.ProveAt(2, label); !errb {
+		t.Fatal()
+	}
+	for epoch := uint64(3); epoch < 5; epoch++ {
+		dig, errb := tr.DigestAt(epoch)
+		if errb || !bytes.Equal(dig, digs[epoch]) {
+			t.Fatal()
+		}
+	}
+	label[0] = 4
+	in, _, proof, errb := tr.ProveAt(3, label)
+	if errb || in || Verify(in, label, nil, proof, digs[3]) {
+		t.Fatal()
+	}
+
+	// a copy keeps the same numbering.
+	cp := tr.Clone()
+	if epoch, errb := cp.Snapshot(); errb || epoch != 5 {
+		t.Fatal()
+	}
+	tr.Prune(100)
+	if _, errb := tr.DigestAt(4); !errb {
+		t.Fatal()
+	}
+	if epoch, errb := tr.Snapshot(); errb || epoch != 5 {
+		t.Fatal()
+	}
+	if _, errb := cp.DigestAt(3); errb {
+		t.Fatal()
+	}
+}
+
+func TestClone(t *testing.T) {
+	tr := NewTree()
+	l0 := make([]byte, cryptoffi.HashLen)
+	l1 := bytes.Repeat([]byte{1}, int(cryptoffi.HashLen))
+	if tr.Put(l0, []byte{0}) {
+		t.Fatal()
+	}
+	if _, errb := tr.Snapshot(); errb {
+		t.Fatal()
+	}
+	dig0 := tr.Digest()
+
+	// changes to the copy don't leak into the original.
+	cp := tr.Clone()
+	if cp.Put(l1, []byte{1}) {
+		t.Fatal()
+	}
+	if epoch, errb := cp.Snapshot(); errb || epoch != 1 {
+		t.Fatal()
+	}
+	if !bytes.Equal(tr.Digest(), dig0) {
+		t.Fatal()
+	}
+	if in, _ := tr.Get(l1); in {
+		t.Fatal()
+	}
+	if _, errb := tr.DigestAt(1); !errb {
+		t.Fatal()
+	}
+
+	// or the other way around.
+	if tr.Put(l1, []byte{2}) {
+		t.Fatal()
+	}
+	if epoch, errb := tr.Snapshot(); errb || epoch != 1 {
+		t.Fatal()
+	}
+	_, v, _, errb := cp.ProveAt(1, l1)
+	if errb || !bytes.Equal(v, []byte{1}) {
+		t.Fatal()
+	}
+}
+
+func TestDiskTree(t *testing.T) {
+	mem := NewTree()
+	disk, errb := NewDiskTree(cryptoffi.HashSuiteSha256, filepath.Join(t.TempDir(), "tree"), 1_000)
+	if errb {
+		t.Fatal()
+	}
+	var seed [32]byte
+	rnd := rand.NewChaCha8(seed)
+	label := make([]byte, cryptoffi.HashLen)
+	val := make([]byte, 4)
+	var labels [][]byte
+
+	// enough puts to flush within an epoch.
+	for i := 0; i < 50_000; i++ {
+		if i%10_000 == 0 {
+			if _, errb := mem.Snapshot(); errb {
+				t.Fatal()
+			}
+			if _, errb := disk.Snapshot(); errb {
+				t.Fatal()
+			}
+		}
+		_, err := rnd.Read(label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rnd.Read(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels = append(labels, bytes.Clone(label))
+		if mem.Put(bytes.Clone(label), bytes.Clone(val)) {
+			t.Fatal()
+		}
+		if disk.Put(bytes.Clone(label), bytes.Clone(val)) {
+			t.Fatal()
+		}
+	}
+	if !bytes.Equal(mem.Digest(), disk.Digest()) {
+		t.Fatal()
+	}
+
+	for i, l := range labels {
+		if i%100 != 0 {
+			continue
+		}
+		in0, v0, p0 := mem.Prove(l)
+		in1, v1, p1 := disk.Prove(l)
+		if in0 != in1 || !bytes.Equal(v0, v1) || !bytes.Equal(p0, p1) {
+			t.Fatal()
+		}
+		in0, v0, p0, _ = mem.ProveAt(2, l)
+		in1, v1, p1, _ = disk.ProveAt(2, l)
+		if in0 != in1 || !bytes.Equal(v0, v1) || !bytes.Equal(p0, p1) {
+			t.Fatal()
+		}
+	}
+	if disk.Close() {
+		t.Fatal()
+	}
+}
+
+func TestDiskErr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	// no cache, so that every load hits the disk.
+	disk, errb := NewDiskTree(cryptoffi.HashSuiteSha256, path, 0)
+	if errb {
+		t.Fatal()
+	}
+	// an existing tree doesn't get truncated.
+	if _, errb := NewDiskTree(cryptoffi.HashSuiteSha256, path, 1_000); !errb {
+		t.Fatal()
+	}
+	l0 := make([]byte, cryptoffi.HashLen)
+	l1 := bytes.Repeat([]byte{1}, int(cryptoffi.HashLen))
+	if disk.Put(l0, []byte{0}) {
+		t.Fatal()
+	}
+	if _, errb := disk.Snapshot(); errb {
+		t.Fatal()
+	}
+	if disk.Put(l1, []byte{1}) {
+		t.Fatal()
+	}
+	dig := disk.Digest()
+
+	// disk fails come back as errors, and leave the tree as is.
+	disk.ctx.store.f.Close()
+	if _, errb := disk.Snapshot(); !errb {
+		t.Fatal()
+	}
+	if _, errb := disk.DigestAt(1); !errb {
+		t.Fatal()
+	}
+	if !disk.Put(l0, []byte{1}) {
+		t.Fatal()
+	}
+	if !disk.PutBatch([][]byte{l0, l1}, [][]byte{{1}, {2}}) {
+		t.Fatal()
+	}
+	if _, _, _, errb := disk.ProveAt(0, l0); !errb {
+		t.Fatal()
+	}
+	if !bytes.Equal(disk.Digest(), dig) {
+		t.Fatal()
+	}
+	if !disk.Close() {
+		t.Fatal()
+	}
+}
+
+func TestPutBatch(t *testing.T) {
+	tr0 := NewTree()
+	tr1 := NewTree()
+	var seed [32]byte
+	rnd := rand.NewChaCha8(seed)
+	label := make([]byte, cryptoffi.HashLen)
+	val := make([]byte, 4)
+	var prev [][]byte
+
+	for _, sz := range []int{1, 2, 10, 1_000, 10_000} {
+		var labels [][]byte
+		var vals [][]byte
+		for i := 0; i < sz; i++ {
+			_, err := rnd.Read(label)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rnd.Read(val)
+			if err != nil {
+				t.Fatal(err)
+			}
+			labels = append(labels, bytes.Clone(label))
+			vals = append(vals, bytes.Clone(val))
+		}
+		// overwrite some existing labels, and put some twice.
+		for i := 0; i < len(prev) && i < 5; i++ {
+			labels = append(labels, prev[i])
+			vals = append(vals, []byte{byte(i)})
+		}
+		labels = append(labels, labels[0])
+		vals = append(vals, []byte{1, 2})
+
+		for i := range labels {
+			if tr0.Put(labels[i], vals[i]) {
+				t.Fatal()
+			}
+		}
+		if tr1.PutBatch(labels, vals) {
+			t.Fatal()
+		}
+		if !bytes.Equal(tr0.Digest(), tr1.Digest()) {
+			t.Fatal()
+		}
+		for _, l := range labels {
+			_, v, _ := tr0.Prove(l)
+			proveAndVerify(t, tr1, l, true, v)
+		}
+		prev = labels
+	}
+
+	if !tr1.PutBatch([][]byte{{1}}, [][]byte{{1}}) {
+		t.Fatal()
+	}
+	if !tr1.PutBatch([][]byte{label}, nil) {
+		t.Fatal()
+	}
+}
+
+func TestSuites(t *testing.T) {
+	label := make([]byte, cryptoffi.HashLen)
+	val := []byte{1}
+	suites := []uint64{cryptoffi.HashSuiteSha256, cryptoffi.HashSuiteSha512_256, cryptoffi.HashSuiteBlake3}
+	var digs [][]byte
+	for _, suite := range suites {
+		tr := NewTreeSuite(suite)
+		if tr.Put(label, val) {
+			t.Fatal()
+		}
+		dig := tr.Digest()
+		inTree, v, proof := tr.Prove(label)
+		if !inTree {
+			t.Fatal()
+		}
+		if VerifySuite(suite, true, label, v, proof, dig) {
+			t.Fatal()
+		}
+		for _, d := range digs {
+			if bytes.Equal(d, dig) {
+				t.Fatal()
+			}
+		}
+		digs = append(digs, dig)
+	}
+
+	// proofs don't verify under a different suite.
+	tr := NewTreeSuite(cryptoffi.HashSuiteBlake3)
+	if tr.Put(label, val) {
+		t.Fatal()
+	}
+	_, v, proof := tr.Prove(label)
+	if !Verify(true, label, v, proof, tr.Digest()) {
+		t.Fatal()
+	}
+}
+
 func proveAndVerify(t *testing.T, tr *Tree, label []byte, expInTree bool, expVal []byte) {
 	inTree, val, proof := tr.Prove(label)
 	if inTree != expInTree {
@@ -0,0 +1,248 @@
+package merkle
+
+// store is an unverified disk backend for large trees.
+// since nodes are immutable, it's an append-only file of node records.
+// inner records reference children by file offset and carry their hashes,
+// so proofs only load the nodes on the label path.
+
+import (
+	"bufio"
+	"container/list"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mit-pdos/pav/cryptoffi"
+	"github.com/mit-pdos/pav/marshalutil"
+	"github.com/tchajed/marshal"
+)
+
+const (
+	// storeMagic starts every store file, which also keeps
+	// offset 0 free to mean "not on disk".
+	storeMagic uint64 = 0x7061766d65726b31
+	// maxPending bounds the number of Puts between flushes.
+	maxPending uint64 = 1 << 14
+)
+
+type store struct {
+	f    *os.File
+	w    *bufio.Writer
+	size uint64
+	// pending counts Puts since the last flush.
+	pending uint64
+	cache   *nodeCache
+}
+
+// nodeCache is an LRU cache of loaded nodes, keyed by offset.
+type nodeCache struct {
+	mu    *sync.Mutex
+	cap   uint64
+	lru   *list.List
+	elems map[uint64]*list.Element
+}
+
+// newStore makes a store in a new file at path.
+// it errors if the file already exists, rather than truncating it.
+func newStore(path string, cacheSz uint64) (*store, bool) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, true
+	}
+	w := bufio.NewWriter(f)
+	_, err = w.Write(marshal.WriteInt(nil, storeMagic))
+	if err != nil {
+		f.Close()
+		return nil, true
+	}
+	c := &nodeCache{mu: new(sync.Mutex), cap: cacheSz, lru: list.New(), elems: make(map[uint64]*list.Element)}
+	return &store{f: f, w: w, size: 8, cache: c}, false
+}
+
+// flush writes all in-memory nodes under n to disk and
+// returns a stub for n. it errors on a failed write, after which
+// the store stays failed.
+func (st *store) flush(n *node) (*node, bool) {
+	stub, err := st.write(n)
+	if err {
+		return nil, true
+	}
+	if err := st.w.Flush(); err != nil {
+		return nil, true
+	}
+	st.pending = 0
+	return stub, false
+}
+
+// write appends the in-memory nodes under n in post-order,
+// returning a stub with n's hash and offset. it errors on a failed write.
+func (st *store) write(n *node) (*node, bool) {
+	if n == nil || n.off != 0 {
+		return n, false
+	}
+	var rec []byte
+	if n.child0 == nil && n.child1 == nil {
+		rec = make([]byte, 0, 1+cryptoffi.HashLen+8+uint64(len(n.label))+8+uint64(len(n.val)))
+		rec = marshalutil.WriteByte(rec, leafNodeTag)
+		rec = marshal.WriteBytes(rec, n.hash)
+		rec = marshalutil.WriteSlice1D(rec, n.label)
+		rec = marshalutil.WriteSlice1D(rec, n.val)
+	} else {
+		c0, err0 := st.write(n.child0)
+		if err0 {
+			return nil, true
+		}
+		c1, err1 := st.write(n.child1)
+		if err1 {
+			return nil, true
+		}
+		rec = make([]byte, 0, 1+3*(8+cryptoffi.HashLen))
+		rec = marshalutil.WriteByte(rec, innerNodeTag)
+		rec = marshal.WriteBytes(rec, n.hash)
+		rec = writeRef(rec, c0)
+		rec = writeRef(rec, c1)
+	}
+
+	off := st.size
+	hdr := marshal.WriteInt(make([]byte, 0, 8), uint64(len(rec)))
+	if _, err := st.w.Write(hdr); err != nil {
+		return nil, true
+	}
+	if _, err := st.w.Write(rec); err != nil {
+		return nil, true
+	}
+	st.size += 8 + uint64(len(rec))
+	return &node{hash: n.hash, off: off}, false
+}
+
+// writeRef encodes a child as its offset (0 for empty) and hash.
+func writeRef(b0 []byte, n *node) []byte {
+	var b = b0
+	if n == nil {
+		return marshal.WriteInt(b, 0)
+	}
+	b = marshal.WriteInt(b, n.off)
+	b = marshal.WriteBytes(b, n.hash)
+	return b
+}
+
+func readRef(b0 []byte) (*node, []byte, bool) {
+	off, b1, err0 := marshalutil.ReadInt(b0)
+	if err0 {
+		return nil, nil, true
+	}
+	if off == 0 {
+		return nil, b1, false
+	}
+	hash, b2, err1 := marshalutil.ReadBytes(b1, cryptoffi.HashLen)
+	if err1 {
+		return nil, nil, true
+	}
+	return &node{hash: hash, off: off}, b2, false
+}
+
+// get returns the full node at off, with children as stubs.
+// it errors on a failed read.
+func (st *store) get(off uint64) (*node, bool) {
+	n0, ok := st.cache.get(off)
+	if ok {
+		return n0, false
+	}
+	n, err := st.read(off)
+	if err {
+		return nil, true
+	}
+	st.cache.put(off, n)
+	return n, false
+}
+
+// read errors on a failed read or a corrupt record.
+func (st *store) read(off uint64) (*node, bool) {
+	hdr := make([]byte, 8)
+	if _, err := st.f.ReadAt(hdr, int64(off)); err != nil && err != io.EOF {
+		return nil, true
+	}
+	recLen, _ := marshal.ReadInt(hdr)
+	rec := make([]byte, recLen)
+	if _, err := st.f.ReadAt(rec, int64(off+8)); err != nil && err != io.EOF {
+		return nil, true
+	}
+	n, err := decodeRec(rec)
+	if err {
+		return nil, true
+	}
+	n.off = off
+	return n, false
+}
+
+func decodeRec(b0 []byte) (*node, bool) {
+	tag, b1, err0 := marshalutil.ReadByte(b0)
+	if err0 {
+		return nil, true
+	}
+	hash, b2, err1 := marshalutil.ReadBytes(b1, cryptoffi.HashLen)
+	if err1 {
+		return nil, true
+	}
+	if tag == leafNodeTag {
+		label, b3, err2 := marshalutil.ReadSlice1D(b2)
+		if err2 {
+			return nil, true
+		}
+		val, _, err3 := marshalutil.ReadSlice1D(b3)
+		if err3 {
+			return nil, true
+		}
+		return &node{hash: hash, label: label, val: val}, false
+	}
+	if tag != innerNodeTag {
+		return nil, true
+	}
+	c0, b3, err2 := readRef(b2)
+	if err2 {
+		return nil, true
+	}
+	c1, _, err3 := readRef(b3)
+	if err3 {
+		return nil, true
+	}
+	return &node{hash: hash, child0: c0, child1: c1}, false
+}
+
+func (st *store) close() bool {
+	if err := st.w.Flush(); err != nil {
+		st.f.Close()
+		return true
+	}
+	return st.f.Close() != nil
+}
+
+type cacheEntry struct {
+	off uint64
+	n   *node
+}
+
+func (c *nodeCache) get(off uint64) (*node, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.elems[off]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).n, true
+}
+
+func (c *nodeCache) put(off uint64, n *node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.elems[off]; ok {
+		return
+	}
+	c.elems[off] = c.lru.PushFront(&cacheEntry{off: off, n: n})
+	for uint64(c.lru.Len()) > c.cap {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.elems, last.Value.(*cacheEntry).off)
+	}
+}
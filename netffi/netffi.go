@@ -8,11 +8,13 @@ package netffi
 // [grove]: https://github.com/mit-pdos/gokv/blob/05f31d837641498c3ca5d72f7ea9a6e6b2263e2c/grove_ffi/network.go
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/tchajed/marshal"
 	"io"
 	"net"
 	"sync"
+	"time"
 )
 
 func addrToStr(addr uint64) string {
@@ -28,22 +30,116 @@ func addrToStr(addr uint64) string {
 	return fmt.Sprintf("%s:%d", net.IPv4(a0, a1, a2, a3).String(), port)
 }
 
+// # Addr
+
+// Addr is a network address.
+// verified code uses the packed uint64 form, which only covers IPv4,
+// whereas Addr also covers hostnames, IPv6, and Unix sockets.
+type Addr struct {
+	// Network is "tcp" or "unix".
+	Network string
+	// Str is "host:port" for tcp, where host can be a hostname,
+	// IPv4, or bracketed IPv6 address. it's a file path for unix.
+	Str string
+}
+
+// Uint64Addr converts a packed IPv4 address and port.
+func Uint64Addr(addr uint64) *Addr {
+	return &Addr{Network: "tcp", Str: addrToStr(addr)}
+}
+
+// TCPAddr returns a tcp address for hostPort.
+func TCPAddr(hostPort string) *Addr {
+	return &Addr{Network: "tcp", Str: hostPort}
+}
+
+// UnixAddr returns a Unix socket address for path.
+func UnixAddr(path string) *Addr {
+	return &Addr{Network: "unix", Str: path}
+}
+
+func (a *Addr) String() string {
+	return a.Network + "://" + a.Str
+}
+
+// Opts configures optional transport features and resource limits.
+// a nil *Opts is the same as the zero Opts.
+type Opts struct {
+	// TLS, if non-nil, encrypts and authenticates the transport.
+	// both sides must agree on whether to use it.
+	TLS *tls.Config
+	// MaxFrame bounds the size of a received frame, in bytes.
+	// 0 means DefaultMaxFrame.
+	MaxFrame uint64
+	// ReadTimeout bounds how long a Receive waits, in nanoseconds.
+	// 0 means no bound.
+	ReadTimeout uint64
+	// MaxConns bounds the number of open conns from a Listener.
+	// Accept waits for a free slot. 0 means no bound.
+	MaxConns uint64
+}
+
+const (
+	// DefaultMaxFrame is the default bound on received frames.
+	DefaultMaxFrame uint64 = 1 << 28
+)
+
+func (o *Opts) maxFrame() uint64 {
+	if o == nil || o.MaxFrame == 0 {
+		return DefaultMaxFrame
+	}
+	return o.MaxFrame
+}
+
+func (o *Opts) readTimeout() uint64 {
+	if o == nil {
+		return 0
+	}
+	return o.ReadTimeout
+}
+
 // # Conn
 
 type Conn struct {
-	c      net.Conn
-	sendMu *sync.Mutex
-	recvMu *sync.Mutex
+	c           net.Conn
+	sendMu      *sync.Mutex
+	recvMu      *sync.Mutex
+	maxFrame    uint64
+	readTimeout uint64
+	// release, if non-nil, frees the conn's Listener slot.
+	release *sync.Once
+	slots   chan struct{}
 }
 
 // Dial returns new connection and errors on fail.
-func Dial(addr uint64) *Conn {
-	conn, err := net.Dial("tcp", addrToStr(addr))
+func Dial(addr uint64) (*Conn, bool) {
+	return DialAddr(Uint64Addr(addr), nil)
+}
+
+// DialAddr is like Dial, but with a general addr and opts.
+func DialAddr(addr *Addr, opts *Opts) (*Conn, bool) {
+	conn, err := net.Dial(addr.Network, addr.Str)
 	if err != nil {
-		// hard for client's to recover if there's an addr err, so fail loudly.
-		panic("netffi: Dial err")
+		return nil, true
+	}
+	if opts == nil || opts.TLS == nil {
+		return newConn(conn, opts, nil), false
 	}
-	return newConn(conn)
+	var cfg = opts.TLS
+	if cfg.ServerName == "" && addr.Network == "tcp" {
+		// let the TLS lib validate hostnames, if the config needs it.
+		host, _, err := net.SplitHostPort(addr.Str)
+		if err == nil {
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if tlsConn.Handshake() != nil {
+		conn.Close()
+		return nil, true
+	}
+	return newConn(tlsConn, opts, nil), false
 }
 
 func (c *Conn) Send(data []byte) bool {
@@ -58,14 +154,34 @@ func (c *Conn) Send(data []byte) bool {
 	_, err := c.c.Write(msg)
 	if err != nil {
 		// prevent sending on this conn again.
-		c.c.Close()
+		c.Close()
 		return true
 	}
 	return false
 }
 
-func newConn(conn net.Conn) *Conn {
-	return &Conn{c: conn, sendMu: new(sync.Mutex), recvMu: new(sync.Mutex)}
+func newConn(conn net.Conn, opts *Opts, slots chan struct{}) *Conn {
+	var release *sync.Once
+	if slots != nil {
+		release = new(sync.Once)
+	}
+	return &Conn{c: conn, sendMu: new(sync.Mutex), recvMu: new(sync.Mutex), maxFrame: opts.maxFrame(), readTimeout: opts.readTimeout(), release: release, slots: slots}
+}
+
+// SetDeadline makes pending and future Send and Receive calls
+// error after t. the zero t means no deadline.
+func (c *Conn) SetDeadline(t time.Time) {
+	c.c.SetDeadline(t)
+}
+
+// Close closes the connection, after which Send and Receive error.
+func (c *Conn) Close() {
+	c.c.Close()
+	if c.release != nil {
+		c.release.Do(func() {
+			<-c.slots
+		})
+	}
 }
 
 // Receive returns data and errors on fail.
@@ -73,6 +189,10 @@ func (c *Conn) Receive() ([]byte, bool) {
 	c.recvMu.Lock()
 	defer c.recvMu.Unlock()
 
+	if c.readTimeout != 0 {
+		c.c.SetReadDeadline(time.Now().Add(time.Duration(c.readTimeout)))
+	}
+
 	// encoding: len(data) ++ data.
 	header := make([]byte, 8)
 	_, err0 := io.ReadFull(c.c, header)
@@ -81,17 +201,24 @@ func (c *Conn) Receive() ([]byte, bool) {
 		// This can legitimately happen when the other side "hung up", so do not panic.
 		// But also, we clearly lost track here of where in the protocol we are,
 		// so close it.
-		c.c.Close()
+		c.Close()
 		return nil, true
 	}
 	d := marshal.NewDec(header)
 	dataLen := d.GetInt()
+	if dataLen > c.maxFrame {
+		// the peer is misbehaving, and we can't skip the frame
+		// without reading it.
+		c.Close()
+		return nil, true
+	}
 
-	data := make([]byte, dataLen)
-	_, err1 := io.ReadFull(c.c, data)
-	if err1 != nil {
+	// grow the buffer as bytes arrive, so a peer can't make us
+	// allocate a big frame without sending it.
+	data, err1 := io.ReadAll(io.LimitReader(c.c, int64(dataLen)))
+	if err1 != nil || uint64(len(data)) != dataLen {
 		// prevent sending on this conn again.
-		c.c.Close()
+		c.Close()
 		return nil, true
 	}
 	return data, false
@@ -100,23 +227,61 @@ func (c *Conn) Receive() ([]byte, bool) {
 // # Listener
 
 type Listener struct {
-	l net.Listener
+	l    net.Listener
+	opts *Opts
+	// slots, if non-nil, has an entry for each open conn.
+	slots chan struct{}
+}
+
+// Listen returns a new listener and errors on fail,
+// e.g., if the port is already in use.
+func Listen(addr uint64) (*Listener, bool) {
+	return ListenAddr(Uint64Addr(addr), nil)
 }
 
-func Listen(addr uint64) *Listener {
-	l, err := net.Listen("tcp", addrToStr(addr))
+// ListenAddr is like Listen, but with a general addr and opts.
+// with TLS, the handshake happens on a conn's first Send or Receive.
+func ListenAddr(addr *Addr, opts *Opts) (*Listener, bool) {
+	l, err := net.Listen(addr.Network, addr.Str)
 	if err != nil {
-		// assume no Listen err. likely, port is already in use.
-		panic("netffi: Listen err")
+		return nil, true
+	}
+	var slots chan struct{}
+	if opts != nil && opts.MaxConns != 0 {
+		slots = make(chan struct{}, opts.MaxConns)
+	}
+	if opts != nil && opts.TLS != nil {
+		return &Listener{l: tls.NewListener(l, opts.TLS), opts: opts, slots: slots}, false
 	}
-	return &Listener{l}
+	return &Listener{l: l, opts: opts, slots: slots}, false
 }
 
-func (l *Listener) Accept() *Conn {
+// Addr returns the listening addr, which has the actual port
+// if the listen addr asked for port 0.
+func (l *Listener) Addr() *Addr {
+	a := l.l.Addr()
+	return &Addr{Network: a.Network(), Str: a.String()}
+}
+
+// Close stops the listener, after which Accept errors.
+// it doesn't close accepted conns.
+func (l *Listener) Close() {
+	l.l.Close()
+}
+
+// Accept returns the next connection and errors on fail.
+// errors may be transient, e.g., from running out of file descriptors.
+// with MaxConns, it first waits for an open conn to close.
+func (l *Listener) Accept() (*Conn, bool) {
+	if l.slots != nil {
+		l.slots <- struct{}{}
+	}
 	conn, err := l.l.Accept()
 	if err != nil {
-		// assume no Accept err.
-		panic("netffi: Accept err")
+		if l.slots != nil {
+			<-l.slots
+		}
+		return nil, true
 	}
-	return newConn(conn)
+	return newConn(conn, l.opts, l.slots), false
 }
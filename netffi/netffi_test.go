@@ -2,22 +2,36 @@ package netffi
 
 import (
 	"bytes"
+	"github.com/mit-pdos/pav/cryptoffi"
+	"github.com/tchajed/marshal"
 	"math/rand/v2"
+	"net"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNet(t *testing.T) {
 	addr := makeUniqueAddr()
-	l := Listen(addr)
+	l, err0 := Listen(addr)
+	if err0 {
+		t.Fatal()
+	}
 
-	c0 := Dial(addr)
+	c0, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
 	d0 := []byte{1, 2}
 	err1 := c0.Send(d0)
 	if err1 {
 		t.Fatal()
 	}
 
-	c1 := l.Accept()
+	c1, err0 := l.Accept()
+	if err0 {
+		t.Fatal()
+	}
 	d1, err2 := c1.Receive()
 	if err2 {
 		t.Fatal()
@@ -27,6 +41,198 @@ func TestNet(t *testing.T) {
 	}
 }
 
+func TestNetTLS(t *testing.T) {
+	pk, sk := cryptoffi.SigGenerateKey()
+	addr := makeUniqueAddr()
+	l, err0 := ListenAddr(Uint64Addr(addr), &Opts{TLS: cryptoffi.TLSServerConfig(sk)})
+	if err0 {
+		t.Fatal()
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err {
+				return
+			}
+			go func() {
+				// echo.
+				d, err := c.Receive()
+				if err {
+					return
+				}
+				c.Send(d)
+			}()
+		}
+	}()
+
+	c0, err0 := DialAddr(Uint64Addr(addr), &Opts{TLS: cryptoffi.TLSClientConfig(pk)})
+	if err0 {
+		t.Fatal()
+	}
+	d0 := []byte{1, 2}
+	if c0.Send(d0) {
+		t.Fatal()
+	}
+	d1, err := c0.Receive()
+	if err {
+		t.Fatal()
+	}
+	if !bytes.Equal(d0, d1) {
+		t.Fatal()
+	}
+
+	// clients reject a server with a different pk.
+	pk1, _ := cryptoffi.SigGenerateKey()
+	_, err0 = DialAddr(Uint64Addr(addr), &Opts{TLS: cryptoffi.TLSClientConfig(pk1)})
+	if !err0 {
+		t.Fatal()
+	}
+}
+
+func TestNetErr(t *testing.T) {
+	addr := makeUniqueAddr()
+	// no listener.
+	if _, err := Dial(addr); !err {
+		t.Fatal()
+	}
+	l, err := Listen(addr)
+	if err {
+		t.Fatal()
+	}
+	// port in use.
+	if _, err = Listen(addr); !err {
+		t.Fatal()
+	}
+	// closed listener.
+	l.l.Close()
+	if _, err = l.Accept(); !err {
+		t.Fatal()
+	}
+}
+
+func TestNetLimits(t *testing.T) {
+	addr := makeUniqueAddr()
+	opts := &Opts{MaxFrame: 4, ReadTimeout: 20_000_000, MaxConns: 1}
+	l, err0 := ListenAddr(Uint64Addr(addr), opts)
+	if err0 {
+		t.Fatal()
+	}
+
+	// frame too big.
+	c0, err0 := Dial(addr)
+	if err0 {
+		t.Fatal()
+	}
+	s0, err0 := l.Accept()
+	if err0 {
+		t.Fatal()
+	}
+	if c0.Send([]byte{1, 2, 3, 4, 5}) {
+		t.Fatal()
+	}
+	if _, err := s0.Receive(); !err {
+		t.Fatal()
+	}
+
+	// huge len header, without the data.
+	c1, err1 := Dial(addr)
+	if err1 {
+		t.Fatal()
+	}
+	s1, err1 := l.Accept()
+	if err1 {
+		t.Fatal()
+	}
+	if _, err := c1.c.Write(marshal.WriteInt(nil, 1<<62)); err != nil {
+		t.Fatal()
+	}
+	if _, err := s1.Receive(); !err {
+		t.Fatal()
+	}
+
+	// read timeout.
+	c2, err2 := Dial(addr)
+	if err2 {
+		t.Fatal()
+	}
+	s2, err2 := l.Accept()
+	if err2 {
+		t.Fatal()
+	}
+	if _, err := s2.Receive(); !err {
+		t.Fatal()
+	}
+
+	// max conns. s2 closed on err, so one more conn fits.
+	c3, err3 := Dial(addr)
+	if err3 {
+		t.Fatal()
+	}
+	s3, err3 := l.Accept()
+	if err3 {
+		t.Fatal()
+	}
+	accepted := make(chan bool)
+	go func() {
+		_, err := l.Accept()
+		accepted <- !err
+	}()
+	if _, err := Dial(addr); err {
+		t.Fatal()
+	}
+	select {
+	case <-accepted:
+		t.Fatal()
+	case <-time.After(20 * time.Millisecond):
+	}
+	s3.Close()
+	if !<-accepted {
+		t.Fatal()
+	}
+	c0.Close()
+	c1.Close()
+	c2.Close()
+	c3.Close()
+}
+
+func TestNetAddrs(t *testing.T) {
+	addrs := []*Addr{
+		TCPAddr("localhost:0"),
+		UnixAddr(filepath.Join(t.TempDir(), "sock")),
+	}
+	// not all hosts have IPv6.
+	if l, err := net.Listen("tcp6", "[::1]:0"); err == nil {
+		l.Close()
+		addrs = append(addrs, TCPAddr("[::1]:0"))
+	}
+
+	for _, addr := range addrs {
+		l, err := ListenAddr(addr, nil)
+		if err {
+			t.Fatal(addr)
+		}
+		c0, err := DialAddr(l.Addr(), nil)
+		if err {
+			t.Fatal(addr)
+		}
+		d0 := []byte{1, 2}
+		if c0.Send(d0) {
+			t.Fatal(addr)
+		}
+		c1, err := l.Accept()
+		if err {
+			t.Fatal(addr)
+		}
+		d1, err := c1.Receive()
+		if err {
+			t.Fatal(addr)
+		}
+		if !bytes.Equal(d0, d1) {
+			t.Fatal(addr)
+		}
+	}
+}
+
 func makeUniqueAddr() uint64 {
 	port := uint64(rand.IntN(4000)) + 6000
 	// left shift to make IP 0.0.0.0.